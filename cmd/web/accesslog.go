@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The timestamp layout used by the Common and Combined Log Formats.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// An accessRecorder wraps a ResponseWriter to note the status code and the
+// number of body bytes written, for the access log. Unwrap lets
+// http.ResponseController reach the underlying writer, so flushing (for the
+// event stream) still works through it.
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *accessRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *accessRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *accessRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Escape a value for a quoted CLF field, the way Apache does for quotes and
+// backslashes.
+var clfEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Format one request as a line in the Combined Log Format:
+//
+//	host - - [time] "method uri proto" status bytes "referer" "user-agent"
+//
+// Missing values are logged as "-", as is a body of 0 bytes. A status of 0
+// (nothing was written) is logged as 200, which is what net/http sends.
+func combinedLogLine(ip string, t time.Time, r *http.Request, status, bytes int) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	size := "-"
+	if bytes > 0 {
+		size = strconv.Itoa(bytes)
+	}
+
+	quoted := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return clfEscaper.Replace(s)
+	}
+
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		ip,
+		t.Format(clfTimeLayout),
+		quoted(r.Method), quoted(r.URL.RequestURI()), quoted(r.Proto),
+		status,
+		size,
+		quoted(r.Referer()),
+		quoted(r.UserAgent()),
+	)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinedLogLine(t *testing.T) {
+	at := time.Date(2024, time.March, 5, 14, 3, 9, 0, time.FixedZone("", -5*60*60))
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		status  int
+		bytes   int
+		want    string
+	}{
+		{
+			name: "Full",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/snippet/view/1?lines=1", nil)
+				r.Header.Set("Referer", "https://example.com/")
+				r.Header.Set("User-Agent", "curl/8.0")
+				return r
+			},
+			status: http.StatusOK,
+			bytes:  1234,
+			want:   `203.0.113.7 - - [05/Mar/2024:14:03:09 -0500] "GET /snippet/view/1?lines=1 HTTP/1.1" 200 1234 "https://example.com/" "curl/8.0"` + "\n",
+		},
+		{
+			name: "Missing values",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+			},
+			status: http.StatusSeeOther,
+			want:   `203.0.113.7 - - [05/Mar/2024:14:03:09 -0500] "POST /user/logout HTTP/1.1" 303 - "-" "-"` + "\n",
+		},
+		{
+			name: "Nothing written",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/", nil)
+			},
+			want: `203.0.113.7 - - [05/Mar/2024:14:03:09 -0500] "GET / HTTP/1.1" 200 - "-" "-"` + "\n",
+		},
+		{
+			name: "Quotes escaped",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("User-Agent", `evil" "agent\`)
+				return r
+			},
+			status: http.StatusOK,
+			bytes:  5,
+			want:   `203.0.113.7 - - [05/Mar/2024:14:03:09 -0500] "GET / HTTP/1.1" 200 5 "-" "evil\" \"agent\\"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := combinedLogLine("203.0.113.7", at, tt.request(), tt.status, tt.bytes)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogRequestFormats(t *testing.T) {
+	combinedLine := regexp.MustCompile(`^127\.0\.0\.1 - - \[[^\]]+\] "GET /healthz\?full=1 HTTP/1\.1" 200 \d+ "https://example\.com/" "test-agent"\n$`)
+
+	tests := []struct {
+		format       string
+		wantSlog     bool
+		wantCombined bool
+	}{
+		{"slog", true, false},
+		{"combined", false, true},
+		{"both", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var logs, accessLog bytes.Buffer
+
+			app := newTestApplication(t)
+			app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+			app.logAccessFormat = tt.format
+			app.accessLog = &accessLog
+			ts := newTestServer(t, app.routes())
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/healthz?full=1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", "test-agent")
+
+			ts.do(t, req)
+
+			if got := strings.Contains(logs.String(), `msg="received request"`); got != tt.wantSlog {
+				t.Errorf("got structured log %t; want %t: %q", got, tt.wantSlog, logs.String())
+			}
+
+			if !tt.wantCombined {
+				if accessLog.Len() != 0 {
+					t.Errorf("want no combined log; got %q", accessLog.String())
+				}
+				return
+			}
+			if !combinedLine.MatchString(accessLog.String()) {
+				t.Errorf("got combined log %q; want a line matching %s", accessLog.String(), combinedLine)
+			}
+		})
+	}
+}
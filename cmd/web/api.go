@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/joshuagageellis/snippetbox.git/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Every API error response uses this envelope. Fields is only present for
+// validation failures and maps field names to messages. RetryAfter is only
+// present when the client should try again later, in seconds.
+type apiError struct {
+	Error      string            `json:"error"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	RetryAfter int               `json:"retry_after,omitempty"`
+}
+
+// The errorResponse helper sends a JSON error envelope with the given status.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message string, fields map[string]string) {
+	err := app.writeJSON(w, status, apiError{Error: message, Fields: fields}, nil)
+	if err != nil {
+		app.requestLogger(r).Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// The retryLaterResponse helper sends a JSON error asking the client to try
+// again in retryAfter seconds, in the body and the Retry-After header. It's
+// used for 429 and 503 responses.
+func (app *application) retryLaterResponse(w http.ResponseWriter, r *http.Request, status int, message string, retryAfter int) {
+	headers := http.Header{"Retry-After": {strconv.Itoa(retryAfter)}}
+
+	err := app.writeJSON(w, status, apiError{Error: message, RetryAfter: retryAfter}, headers)
+	if err != nil {
+		app.requestLogger(r).Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// The serverErrorResponse helper logs the error like serverError does, but
+// answers in JSON.
+func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r).Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.errorResponse(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request", nil)
+}
+
+// The badRequestResponse helper sends a 400 with the given message.
+func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusBadRequest, err.Error(), nil)
+}
+
+// The failedValidationResponse helper sends a 422 listing the field errors
+// collected by a validator. All API write handlers use it.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v validator.Validator) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "validation failed", v.FieldErrors)
+}
+
+// The invalidTokenResponse helper sends a 401 asking for a bearer token.
+func (app *application) invalidTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid or missing authentication token", nil)
+}
+
+// The readJSON helper decodes a request body into dst. The body must be a
+// single JSON object of at most 1MB with no fields dst doesn't know about.
+// Decoding problems are turned into messages precise enough to send back to
+// the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+
+		// A non-pointer or nil dst is a bug in our code, not a bad request.
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+
+		default:
+			return err
+		}
+	}
+
+	// Decode again to make sure there's nothing after the first value.
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// Request body for creating a snippet through the API. Expires is a pointer
+// so that leaving it out (which means the default) can be told apart from
+// sending 0.
+type snippetInput struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Expires *int   `json:"expires"`
+}
+
+// Decode a snippet from the request body and validate it, for both creating
+// and the dry run. The text comes back normalized, along with the expiry
+// (the default if none was sent). If ok is false the error response has
+// already been sent.
+func (app *application) readSnippetInput(w http.ResponseWriter, r *http.Request) (input snippetInput, expires int, ok bool) {
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return input, 0, false
+	}
+
+	expires = app.defaultExpiry
+	if input.Expires != nil {
+		expires = *input.Expires
+	}
+
+	input.Title = normalizeText(input.Title)
+	input.Content = normalizeText(input.Content)
+
+	var v validator.Validator
+
+	app.validateSnippet(&v, input.Title, input.Content, expires)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return input, 0, false
+	}
+
+	return input, expires, true
+}
+
+// Check a snippet as creating it would, without storing anything. Valid
+// input gets {"valid": true}, invalid input the same 422 as create.
+func (app *application) apiSnippetValidate(w http.ResponseWriter, r *http.Request) {
+	_, _, ok := app.readSnippetInput(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, map[string]bool{"valid": true}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	input, expires, ok := app.readSnippetInput(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.checkSnippetQuota(r)
+	if err != nil {
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			app.errorResponse(w, r, http.StatusForbidden, "snippet quota exceeded", nil)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	id, err := app.workspaceSnippets(r).Insert(input.Title, input.Content, expires, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicate) {
+			app.errorResponse(w, r, http.StatusConflict, "the snippet conflicts with an existing one", nil)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	snippetsCreated.Add(1)
+	app.auditLog(r, models.AuditCreate, id, input.Title)
+	app.broadcaster.Publish(snippetEvent{ID: id, Title: input.Title, workspaceID: contextWorkspaceID(r)})
+
+	// Send back the stored snippet, as the database has filled in the
+	// timestamps, so the client needn't fetch it again. It's read from the
+	// primary, as a replica may not have it yet.
+	snippet, err := app.workspaceSnippets(r).GetFromPrimary(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := http.Header{"Location": {fmt.Sprintf("%s/api/v1/snippets/%d", app.basePath, id)}}
+
+	err = app.writeJSON(w, http.StatusCreated, newAPISnippet(snippet), headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Return a single live snippet.
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.errorResponse(w, r, http.StatusNotFound, "the requested snippet could not be found", nil)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorResponse(w, r, http.StatusNotFound, "the requested snippet could not be found", nil)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.errorResponse(w, r, http.StatusServiceUnavailable, "the request timed out, please try again", nil)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, newAPISnippet(snippet), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The most ids a single exists request may ask about.
+const maxExistsIDs = 100
+
+// Report which of a JSON array of snippet ids are still live, as an object
+// mapping each id to true or false.
+func (app *application) apiSnippetsExist(w http.ResponseWriter, r *http.Request) {
+	var ids []int
+
+	err := app.readJSON(w, r, &ids)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(ids) > maxExistsIDs {
+		app.badRequestResponse(w, r, fmt.Errorf("body must contain at most %d ids", maxExistsIDs))
+		return
+	}
+
+	exists, err := app.workspaceSnippets(r).ExistsMany(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, exists, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// A snippet as the API returns it.
+type apiSnippet struct {
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func newAPISnippet(s models.Snippet) apiSnippet {
+	return apiSnippet{ID: s.ID, Title: s.Title, Content: s.Content, Created: s.Created, Expires: s.Expires}
+}
+
+// A page of snippets. NextCursor is the value to pass as ?after= for the
+// following page, and null on the last page.
+type apiSnippetPage struct {
+	Snippets   []apiSnippet `json:"snippets"`
+	NextCursor *int         `json:"next_cursor"`
+}
+
+// List live snippets newest first, a page at a time. Pages are keyed on the
+// id of the last snippet seen (?after=) rather than an offset, so deep pages
+// are as cheap as the first and rows added meanwhile don't shift them.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	cursor := 0
+	if after := qs.Get("after"); after != "" {
+		var err error
+		cursor, err = strconv.Atoi(after)
+		if err != nil || cursor < 1 {
+			app.badRequestResponse(w, r, errors.New("after must be a positive integer"))
+			return
+		}
+	}
+
+	limit := 20
+	if value := qs.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > app.maxListLimit {
+			app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and %d", app.maxListLimit))
+			return
+		}
+	}
+
+	// Fetch one extra to learn whether there's a further page.
+	snippets, err := app.workspaceSnippets(r).After(cursor, limit+1)
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.errorResponse(w, r, http.StatusServiceUnavailable, "the request timed out, please try again", nil)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The total for the X-Total-Count header.
+	total, err := app.workspaceSnippets(r).Count(models.SnippetFilter{})
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.errorResponse(w, r, http.StatusServiceUnavailable, "the request timed out, please try again", nil)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	page := apiSnippetPage{Snippets: []apiSnippet{}}
+
+	// Pages are keyed on cursors rather than numbers, so there's no X-Page
+	// or previous page link.
+	var nextURL string
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+		next := snippets[limit-1].ID
+		page.NextCursor = &next
+		nextURL = app.pageURL(r, "after", strconv.Itoa(next))
+	}
+	setPaginationHeaders(w, total, 0, nextURL, "")
+
+	for _, s := range snippets {
+		page.Snippets = append(page.Snippets, newAPISnippet(s))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, page, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
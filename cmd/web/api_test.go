@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/joshuagageellis/snippetbox.git/internal/models/mocks"
+)
+
+func TestAPISnippetList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, headers, body := ts.get(t, "/api/v1/snippets")
+
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %s", code, http.StatusOK, body)
+	}
+	if got := headers.Get("X-Total-Count"); got != "1" {
+		t.Errorf("got X-Total-Count %q; want %q", got, "1")
+	}
+}
+
+func TestAPISnippetValidationErrors(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		body      string
+		wantField string
+	}{
+		{
+			name:      "Missing title",
+			urlPath:   "/api/v1/snippets/validate",
+			body:      `{"content": "Some content", "expires": 7}`,
+			wantField: "title",
+		},
+		{
+			name:      "Title too long",
+			urlPath:   "/api/v1/snippets/validate",
+			body:      `{"title": "` + strings.Repeat("a", 101) + `", "content": "Some content", "expires": 7}`,
+			wantField: "title",
+		},
+		{
+			name:      "Missing content",
+			urlPath:   "/api/v1/snippets/validate",
+			body:      `{"title": "A title", "expires": 7}`,
+			wantField: "content",
+		},
+		{
+			name:      "Out of range expires",
+			urlPath:   "/api/v1/snippets/validate",
+			body:      `{"title": "A title", "content": "Some content", "expires": 42}`,
+			wantField: "expires",
+		},
+		{
+			name:      "Missing title on create",
+			urlPath:   "/api/v1/snippets",
+			body:      `{"content": "Some content", "expires": 7}`,
+			wantField: "title",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+tt.urlPath, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+			code, headers, body := ts.do(t, req)
+
+			if code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d: %s", code, http.StatusUnprocessableEntity, body)
+			}
+			if got := headers.Get("Content-Type"); got != "application/json" {
+				t.Errorf("got Content-Type %q; want %q", got, "application/json")
+			}
+
+			var envelope map[string]json.RawMessage
+			err = json.Unmarshal([]byte(body), &envelope)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var message string
+			err = json.Unmarshal(envelope["error"], &message)
+			if err != nil || message != "validation failed" {
+				t.Errorf("got error %s; want %q", envelope["error"], "validation failed")
+			}
+
+			var fields map[string]string
+			err = json.Unmarshal(envelope["fields"], &fields)
+			if err != nil {
+				t.Fatalf("decoding fields %s: %v", envelope["fields"], err)
+			}
+			if len(fields) != 1 || fields[tt.wantField] == "" {
+				t.Errorf("got fields %v; want only %q", fields, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestAPISnippetValidate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets/validate", strings.NewReader(`{"title": "A title", "content": "Some content", "expires": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	code, _, body := ts.do(t, req)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %s", code, http.StatusOK, body)
+	}
+
+	var got map[string]bool
+	err = json.Unmarshal([]byte(body), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got["valid"] {
+		t.Errorf("got body %s; want only valid: true", body)
+	}
+
+	// Nothing was stored.
+	_, err = app.snippets.Get(2)
+	if !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "Valid", body: `{"title": "A title", "content": "Some content"}`},
+		{name: "Syntax error", body: `{"title": "A title",}`, wantErr: "body contains badly-formed JSON (at character 21)"},
+		{name: "Truncated", body: `{"title": "A title"`, wantErr: "body contains badly-formed JSON"},
+		{name: "Wrong type", body: `{"title": 42}`, wantErr: `body contains incorrect JSON type for field "title"`},
+		{name: "Wrong top-level type", body: `["A title"]`, wantErr: "body contains incorrect JSON type (at character 1)"},
+		{name: "Empty", body: ``, wantErr: "body must not be empty"},
+		{name: "Unknown field", body: `{"title": "A title", "author": "bob"}`, wantErr: `body contains unknown key "author"`},
+		{name: "Two values", body: `{"title": "A title"}{"title": "Another"}`, wantErr: "body must only contain a single JSON value"},
+		{name: "Too large", body: `{"title": "` + strings.Repeat("a", 1_048_576) + `"}`, wantErr: "body must not be larger than 1048576 bytes"},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/snippets", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			var input snippetInput
+			err := app.readJSON(w, r, &input)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %v; want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPISnippetCreateDefaultExpiry(t *testing.T) {
+	for _, days := range []int{1, 7} {
+		app := newTestApplication(t)
+		app.defaultExpiry = days
+		ts := newTestServer(t, app.routes())
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets", strings.NewReader(`{"title": "A title", "content": "Some content"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+		code, _, body := ts.do(t, req)
+
+		if code != http.StatusCreated {
+			t.Fatalf("got status %d; want %d: %s", code, http.StatusCreated, body)
+		}
+
+		var snippet apiSnippet
+		err = json.Unmarshal([]byte(body), &snippet)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := snippet.Expires.Sub(snippet.Created); got != time.Duration(days)*24*time.Hour {
+			t.Errorf("default expiry %d: got expiry %v after creation; want %d days", days, got, days)
+		}
+	}
+}
+
+func TestAPISnippetsExist(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     map[string]bool
+	}{
+		{
+			name:     "Live and missing",
+			body:     `[1, 99]`,
+			wantCode: http.StatusOK,
+			want:     map[string]bool{"1": true, "99": false},
+		},
+		{
+			name:     "Duplicate ids",
+			body:     `[1, 1, 99, 99]`,
+			wantCode: http.StatusOK,
+			want:     map[string]bool{"1": true, "99": false},
+		},
+		{
+			name:     "Empty list",
+			body:     `[]`,
+			wantCode: http.StatusOK,
+			want:     map[string]bool{},
+		},
+		{
+			name:     "Too many ids",
+			body:     "[" + strings.Repeat("1, ", maxExistsIDs) + "1]",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Not an array",
+			body:     `{"ids": [1]}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets/exists", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+			code, _, body := ts.do(t, req)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d: %s", code, tt.wantCode, body)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			var got map[string]bool
+			err = json.Unmarshal([]byte(body), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+			for id, live := range tt.want {
+				if got[id] != live {
+					t.Errorf("id %s: got %t; want %t", id, got[id], live)
+				}
+			}
+		})
+	}
+}
+
+func TestAPISnippetCreateQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		quota    int
+		extra    bool
+		admin    bool
+		wantCode int
+	}{
+		{name: "Under quota", quota: 2, wantCode: http.StatusCreated},
+		{name: "At quota", quota: 1, wantCode: http.StatusForbidden},
+		{name: "Over quota", quota: 1, extra: true, wantCode: http.StatusForbidden},
+		{name: "Admin over quota", quota: 1, extra: true, admin: true, wantCode: http.StatusCreated},
+		{name: "No quota", quota: 0, extra: true, wantCode: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.snippetQuota = tt.quota
+			ts := newTestServer(t, app.routes())
+
+			// The mock user starts out owning one snippet.
+			if tt.extra {
+				_, err := app.snippets.Insert("Another", "More content", 7, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.admin {
+				app.users.SetAdmin(1, true)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets", strings.NewReader(`{"title": "A title", "content": "Some content", "expires": 7}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+			code, _, body := ts.do(t, req)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d: %s", code, tt.wantCode, body)
+			}
+			if code == http.StatusForbidden && !strings.Contains(body, "snippet quota exceeded") {
+				t.Errorf("got body %q; want it to mention the quota", body)
+			}
+		})
+	}
+}
+
+func TestAPISnippetListCursor(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	// With the inserted snippet there are two, ids 2 and 1.
+	_, err := app.snippets.Insert("Second snippet", "More content", 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type page struct {
+		Snippets []struct {
+			ID int `json:"id"`
+		} `json:"snippets"`
+		NextCursor *int `json:"next_cursor"`
+	}
+
+	getPage := func(urlPath string) page {
+		t.Helper()
+
+		code, _, body := ts.get(t, urlPath)
+		if code != http.StatusOK {
+			t.Fatalf("%s: got status %d; want %d: %s", urlPath, code, http.StatusOK, body)
+		}
+
+		var p page
+		err := json.Unmarshal([]byte(body), &p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	var seen []int
+	urlPath := "/api/v1/snippets?limit=1"
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatal("want the walk to end after two pages")
+		}
+
+		p := getPage(urlPath)
+		if len(p.Snippets) != 1 {
+			t.Fatalf("got %d snippets on page %d; want 1", len(p.Snippets), pages+1)
+		}
+		seen = append(seen, p.Snippets[0].ID)
+
+		if p.NextCursor == nil {
+			break
+		}
+		urlPath = "/api/v1/snippets?limit=1&after=" + strconv.Itoa(*p.NextCursor)
+	}
+
+	// Newest first, with no overlap or gaps.
+	if !slices.Equal(seen, []int{2, 1}) {
+		t.Errorf("got ids %v; want [2 1]", seen)
+	}
+
+	// A page holding everything has no next cursor.
+	if p := getPage("/api/v1/snippets?limit=5"); p.NextCursor != nil || len(p.Snippets) != 2 {
+		t.Errorf("got %d snippets and cursor %v; want 2 and none", len(p.Snippets), p.NextCursor)
+	}
+
+	for _, query := range []string{"after=0", "after=-1", "after=abc", "limit=0", "limit=101", "limit=x"} {
+		code, _, _ := ts.get(t, "/api/v1/snippets?"+query)
+		if code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d; want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+// A snippet model whose replica hasn't caught up: Get doesn't find inserted
+// snippets, only GetFromPrimary does.
+type laggingReplicaSnippetModel struct {
+	*mocks.SnippetModel
+}
+
+func (m laggingReplicaSnippetModel) Get(id int) (models.Snippet, error) {
+	if id != 1 {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+	return m.SnippetModel.Get(id)
+}
+
+func (m laggingReplicaSnippetModel) ForWorkspace(int) models.SnippetModelInterface { return m }
+
+func (m laggingReplicaSnippetModel) WithContext(context.Context) models.SnippetModelInterface {
+	return m
+}
+
+func TestAPISnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippets = laggingReplicaSnippetModel{&mocks.SnippetModel{}}
+	ts := newTestServer(t, app.routes())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets", strings.NewReader(`{"title": "A title", "content": "Some content", "expires": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+	code, headers, body := ts.do(t, req)
+
+	if code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", code, http.StatusCreated, body)
+	}
+	if got := headers.Get("Location"); got != "/api/v1/snippets/2" {
+		t.Errorf("got Location %q; want %q", got, "/api/v1/snippets/2")
+	}
+
+	var snippet apiSnippet
+	err = json.Unmarshal([]byte(body), &snippet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snippet.ID != 2 || snippet.Title != "A title" || snippet.Content != "Some content" {
+		t.Errorf("got snippet %d %q %q; want 2 %q %q", snippet.ID, snippet.Title, snippet.Content, "A title", "Some content")
+	}
+	if got := snippet.Expires.Sub(snippet.Created); got != 7*24*time.Hour {
+		t.Errorf("got expiry %v after creation; want 7 days", got)
+	}
+}
+
+// A snippet model where every insert loses a race on a unique key.
+type duplicateSnippetModel struct {
+	*mocks.SnippetModel
+}
+
+func (m duplicateSnippetModel) Insert(title string, content string, expires int, userID int) (int, error) {
+	return 0, models.ErrDuplicate
+}
+
+func (m duplicateSnippetModel) InsertWithTags(title string, content string, expires int, userID int, tags []string) (int, error) {
+	return 0, models.ErrDuplicate
+}
+
+func (m duplicateSnippetModel) ForWorkspace(int) models.SnippetModelInterface { return m }
+
+func (m duplicateSnippetModel) WithContext(context.Context) models.SnippetModelInterface { return m }
+
+func TestSnippetCreateDuplicate(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippets = duplicateSnippetModel{&mocks.SnippetModel{}}
+	ts := newTestServer(t, app.routes())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets", strings.NewReader(`{"title": "A title", "content": "Some content", "expires": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+	code, _, body := ts.do(t, req)
+
+	if code != http.StatusConflict {
+		t.Fatalf("API: got status %d; want %d: %s", code, http.StatusConflict, body)
+	}
+	if !strings.Contains(body, "the snippet conflicts with an existing one") {
+		t.Errorf("API: got body %q; want the conflict error", body)
+	}
+
+	_, _, body = ts.get(t, "/snippet/create")
+	form := url.Values{}
+	form.Add("title", "A title")
+	form.Add("content", "Some content")
+	form.Add("expires", "7")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ = ts.postForm(t, "/snippet/create", form)
+	if code != http.StatusConflict {
+		t.Errorf("form: got status %d; want %d", code, http.StatusConflict)
+	}
+}
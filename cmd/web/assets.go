@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// How long browsers may cache the favicon and manifest, in seconds.
+const assetMaxAge = "86400"
+
+// Serve the favicon from FAVICON_FILE at /favicon.ico, where browsers look
+// for it whether or not a page links to it.
+func (app *application) favicon(w http.ResponseWriter, r *http.Request) {
+	f, err := os.Open(app.env.FAVICON_FILE)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		app.notFound(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", "public, max-age="+assetMaxAge)
+
+	// ServeContent takes care of conditional requests using the
+	// modification time.
+	http.ServeContent(w, r, "favicon.ico", info.ModTime(), f)
+}
+
+// The web app manifest, letting browsers install the site.
+type webManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	StartURL        string         `json:"start_url"`
+	Display         string         `json:"display"`
+	BackgroundColor string         `json:"background_color"`
+	ThemeColor      string         `json:"theme_color"`
+	Icons           []manifestIcon `json:"icons"`
+}
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// Serve the manifest. Its URLs are absolute paths, so they need the base
+// path like any other link.
+func (app *application) siteWebManifest(w http.ResponseWriter, r *http.Request) {
+	manifest := webManifest{
+		Name:            "Snippetbox",
+		ShortName:       "Snippetbox",
+		StartURL:        app.basePath + "/",
+		Display:         "standalone",
+		BackgroundColor: "#F1F3F6",
+		ThemeColor:      "#34495E",
+		Icons: []manifestIcon{
+			{Src: app.basePath + "/favicon.ico", Sizes: "16x16", Type: "image/x-icon"},
+			{Src: app.basePath + "/static/img/logo.png", Sizes: "32x36", Type: "image/png"},
+		},
+	}
+
+	headers := http.Header{
+		"Content-Type":  {"application/manifest+json"},
+		"Cache-Control": {"public, max-age=" + assetMaxAge},
+	}
+
+	err := app.writeJSON(w, http.StatusOK, manifest, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// Report whether r is for one of the routine assets browsers fetch on every
+// visit, which LOG_ASSET_REQUESTS=false keeps out of the logs.
+func isAssetRequest(r *http.Request) bool {
+	return r.URL.Path == "/favicon.ico" || r.URL.Path == "/site.webmanifest" || strings.HasPrefix(r.URL.Path, "/static/")
+}
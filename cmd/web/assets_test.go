@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFavicon(t *testing.T) {
+	app := newTestApplication(t)
+	app.env.FAVICON_FILE = "./ui/static/img/favicon.ico"
+	ts := newTestServer(t, app.routes())
+
+	code, headers, body := ts.get(t, "/favicon.ico")
+
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if got := headers.Get("Content-Type"); got != "image/x-icon" {
+		t.Errorf("got Content-Type %q; want %q", got, "image/x-icon")
+	}
+	if got := headers.Get("Cache-Control"); got != "public, max-age="+assetMaxAge {
+		t.Errorf("got Cache-Control %q; want %q", got, "public, max-age="+assetMaxAge)
+	}
+	if body == "" {
+		t.Error("want a non-empty body")
+	}
+
+	app.env.FAVICON_FILE = "./ui/static/img/missing.ico"
+
+	code, _, _ = ts.get(t, "/favicon.ico")
+	if code != http.StatusNotFound {
+		t.Errorf("with a missing file got status %d; want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestSiteWebManifest(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, headers, body := ts.get(t, "/site.webmanifest")
+
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if got := headers.Get("Content-Type"); got != "application/manifest+json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/manifest+json")
+	}
+
+	var manifest webManifest
+	err := json.Unmarshal([]byte(body), &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.StartURL != "/" || len(manifest.Icons) != 2 {
+		t.Errorf("got start URL %q and %d icons; want %q and 2", manifest.StartURL, len(manifest.Icons), "/")
+	}
+}
+
+func TestLogAssetRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		logAssets bool
+		urlPath   string
+		wantLog   bool
+	}{
+		{"Favicon logged", true, "/favicon.ico", true},
+		{"Favicon suppressed", false, "/favicon.ico", false},
+		{"Manifest suppressed", false, "/site.webmanifest", false},
+		{"Static file suppressed", false, "/static/css/main.css", false},
+		{"Page still logged", false, "/healthz", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+
+			app := newTestApplication(t)
+			app.logAssets = tt.logAssets
+			app.logAccessFormat = "combined"
+			app.accessLog = &logs
+			ts := newTestServer(t, app.routes())
+
+			ts.get(t, tt.urlPath)
+
+			if got := strings.Contains(logs.String(), tt.urlPath); got != tt.wantLog {
+				t.Errorf("got logged %t; want %t: %q", got, tt.wantLog, logs.String())
+			}
+		})
+	}
+}
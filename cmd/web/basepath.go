@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Turn BASE_PATH into the form used throughout: empty for no prefix,
+// otherwise a cleaned path with a leading slash and no trailing one, e.g.
+// "/snippets".
+func parseBasePath(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "/" {
+		return "", nil
+	}
+
+	if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, "?#") {
+		return "", fmt.Errorf("invalid BASE_PATH %q", value)
+	}
+
+	return path.Clean(value), nil
+}
+
+// Serve next under the base path, with the prefix removed from the request
+// path so routes are matched as usual. Requests outside the prefix get a 404,
+// and the bare prefix is redirected to its trailing slash form (the home
+// page).
+func (app *application) withBasePath(next http.Handler) http.Handler {
+	if app.basePath == "" {
+		return next
+	}
+
+	stripped := http.StripPrefix(app.basePath, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == app.basePath {
+			http.Redirect(w, r, app.basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, app.basePath+"/") {
+			app.notFound(w)
+			return
+		}
+
+		stripped.ServeHTTP(w, r)
+	})
+}
+
+// Redirect to a path within the site, adding the base path.
+func (app *application) redirect(w http.ResponseWriter, r *http.Request, target string, code int) {
+	http.Redirect(w, r, app.basePath+target, code)
+}
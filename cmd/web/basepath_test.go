@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseBasePath(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "/", want: ""},
+		{value: " /snippets ", want: "/snippets"},
+		{value: "/snippets/", want: "/snippets"},
+		{value: "/a//b/../c", want: "/a/c"},
+		{value: "snippets", wantErr: true},
+		{value: "/snippets?x=1", wantErr: true},
+		{value: "/snippets#top", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseBasePath(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasePathRoutes(t *testing.T) {
+	app := newTestApplication(t)
+	app.basePath = "/snippets"
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{name: "Home", urlPath: "/snippets/", wantCode: http.StatusOK},
+		{name: "Snippet", urlPath: "/snippets/snippet/view/1", wantCode: http.StatusOK},
+		{name: "Bare prefix", urlPath: "/snippets", wantCode: http.StatusMovedPermanently, wantLocation: "/snippets/"},
+		{name: "Outside the prefix", urlPath: "/snippet/view/1", wantCode: http.StatusNotFound},
+		{name: "Similar prefix", urlPath: "/snippetsx/", wantCode: http.StatusNotFound},
+		{name: "Redirect", urlPath: "/snippets/favorites", wantCode: http.StatusSeeOther, wantLocation: "/snippets/user/login"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, _ := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := headers.Get("Location"); got != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestBasePathLinks(t *testing.T) {
+	app := newTestApplication(t)
+	app.basePath = "/snippets"
+	ts := newTestServer(t, app.routes())
+
+	_, _, body := ts.get(t, "/snippets/")
+
+	for _, want := range []string{
+		"href='/snippets/snippet/view/1'",
+		"href='/snippets/favicon.ico'",
+		"href='/snippets/site.webmanifest'",
+		"href='/snippets/static/css/main.css",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want body to contain %q", want)
+		}
+	}
+
+	code, _, body := ts.get(t, "/snippets/site.webmanifest")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	var manifest webManifest
+	err := json.Unmarshal([]byte(body), &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.StartURL != "/snippets/" {
+		t.Errorf("got start URL %q; want %q", manifest.StartURL, "/snippets/")
+	}
+	for _, icon := range manifest.Icons {
+		if !strings.HasPrefix(icon.Src, "/snippets/") {
+			t.Errorf("got icon %q; want it under /snippets/", icon.Src)
+		}
+	}
+}
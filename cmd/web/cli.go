@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/joshuagageellis/snippetbox.git/internal/validator"
+)
+
+// Arguments accepted by the create-admin subcommand.
+type createAdminArgs struct {
+	Name     string
+	Email    string
+	Password string
+}
+
+// Parse and validate the create-admin arguments. This is kept apart from the
+// database work so bad input is rejected before we touch the users table.
+func parseCreateAdminArgs(args []string, output io.Writer) (createAdminArgs, error) {
+	var a createAdminArgs
+
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&a.Name, "name", "Admin", "Display name of the admin user")
+	fs.StringVar(&a.Email, "email", "", "Email address of the admin user")
+	fs.StringVar(&a.Password, "password", "", "Password of the admin user")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return a, err
+	}
+
+	if !validator.NotBlank(a.Name) {
+		return a, errors.New("-name cannot be blank")
+	}
+	if !validator.Matches(a.Email, validator.EmailRX) {
+		return a, errors.New("-email must be a valid email address")
+	}
+	if !validator.MinChars(a.Password, 8) {
+		return a, errors.New("-password must be at least 8 characters long")
+	}
+	if !validator.StrongPassword(a.Password) {
+		return a, errors.New("-password must contain letters and at least one number or symbol")
+	}
+
+	return a, nil
+}
+
+// The createAdmin subcommand inserts a user with the admin flag set.
+func (app *application) createAdmin(args []string, output io.Writer) error {
+	a, err := parseCreateAdminArgs(args, output)
+	if err != nil {
+		return err
+	}
+
+	id, err := app.users.Insert(a.Name, a.Email, a.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			return fmt.Errorf("a user with email %s already exists", a.Email)
+		}
+		return err
+	}
+
+	err = app.users.SetAdmin(id, true)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("admin user created", "id", id, "email", a.Email)
+
+	return nil
+}
+
+// Arguments accepted by the backfill subcommand.
+type backfillArgs struct {
+	Field     string
+	BatchSize int
+}
+
+// Parse and validate the backfill arguments.
+func parseBackfillArgs(args []string, output io.Writer) (backfillArgs, error) {
+	var a backfillArgs
+
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&a.Field, "field", "", "Column to populate on existing snippets: slug")
+	fs.IntVar(&a.BatchSize, "batch", 500, "Number of snippets updated per transaction")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return a, err
+	}
+
+	if a.Field != "slug" {
+		return a, fmt.Errorf("-field must be slug, not %q", a.Field)
+	}
+	if a.BatchSize < 1 {
+		return a, errors.New("-batch must be at least 1")
+	}
+
+	return a, nil
+}
+
+// The backfill subcommand populates a newly added column on existing
+// snippets, a batch at a time, logging its progress. Rows which already have
+// a value are skipped, so it can be stopped and run again at any point.
+func (app *application) backfill(snippets *models.SnippetModel, args []string, output io.Writer) error {
+	a, err := parseBackfillArgs(args, output)
+	if err != nil {
+		return err
+	}
+
+	err = snippets.AddSlugColumn()
+	if err != nil {
+		return err
+	}
+
+	total, afterID := 0, 0
+	for {
+		updated, lastID, err := snippets.BackfillSlugs(afterID, a.BatchSize)
+		if err != nil {
+			return err
+		}
+		if lastID == 0 {
+			break
+		}
+
+		total += updated
+		afterID = lastID
+		app.logger.Info("backfilled batch", "field", a.Field, "updated", updated, "total", total, "last_id", lastID)
+	}
+
+	app.logger.Info("backfill complete", "field", a.Field, "total", total)
+
+	return nil
+}
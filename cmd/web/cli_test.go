@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseCreateAdminArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    createAdminArgs
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			args: []string{"-email", "admin@example.com", "-password", "pa$$word1"},
+			want: createAdminArgs{Name: "Admin", Email: "admin@example.com", Password: "pa$$word1"},
+		},
+		{
+			name: "Custom name",
+			args: []string{"-name", "Root", "-email", "root@example.com", "-password", "pa$$word1"},
+			want: createAdminArgs{Name: "Root", Email: "root@example.com", Password: "pa$$word1"},
+		},
+		{
+			name:    "Missing email",
+			args:    []string{"-password", "pa$$word1"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid email",
+			args:    []string{"-email", "admin@", "-password", "pa$$word1"},
+			wantErr: true,
+		},
+		{
+			name:    "Short password",
+			args:    []string{"-email", "admin@example.com", "-password", "pa$$1"},
+			wantErr: true,
+		},
+		{
+			name:    "Weak password",
+			args:    []string{"-email", "admin@example.com", "-password", "password"},
+			wantErr: true,
+		},
+		{
+			name:    "Blank name",
+			args:    []string{"-name", " ", "-email", "admin@example.com", "-password", "pa$$word1"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown flag",
+			args:    []string{"-admin"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCreateAdminArgs(tt.args, io.Discard)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateAdminDuplicateEmail(t *testing.T) {
+	app := newTestApplication(t)
+
+	err := app.createAdmin([]string{"-email", "dupe@example.com", "-password", "pa$$word1"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("got error %v; want one saying the user already exists", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+// Define a custom type for request context keys, so that our keys can't
+// collide with keys set by third-party packages. The keys are only ever used
+// through the typed helpers below.
+type contextKey string
+
+const (
+	isAuthenticatedContextKey = contextKey("isAuthenticated")
+	isAdminContextKey         = contextKey("isAdmin")
+	loggerContextKey          = contextKey("logger")
+	userIDContextKey          = contextKey("userID")
+	workspaceIDContextKey     = contextKey("workspaceID")
+)
+
+// Return a copy of the request with a value stored under key.
+func contextSet(r *http.Request, key contextKey, value any) *http.Request {
+	ctx := context.WithValue(r.Context(), key, value)
+	return r.WithContext(ctx)
+}
+
+// Return a copy of the request marked as (not) authenticated.
+func contextSetAuthenticated(r *http.Request, isAuthenticated bool) *http.Request {
+	return contextSet(r, isAuthenticatedContextKey, isAuthenticated)
+}
+
+// Report whether the request was marked as authenticated. Unset means false.
+func contextIsAuthenticated(r *http.Request) bool {
+	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+	return ok && isAuthenticated
+}
+
+// Return a copy of the request marked as (not) coming from an admin.
+func contextSetAdmin(r *http.Request, isAdmin bool) *http.Request {
+	return contextSet(r, isAdminContextKey, isAdmin)
+}
+
+// Report whether the request was marked as coming from an admin. Unset means
+// false.
+func contextIsAdmin(r *http.Request) bool {
+	isAdmin, ok := r.Context().Value(isAdminContextKey).(bool)
+	return ok && isAdmin
+}
+
+// Return a copy of the request carrying the authenticated user's id.
+func contextSetUserID(r *http.Request, userID int) *http.Request {
+	return contextSet(r, userIDContextKey, userID)
+}
+
+// Return the authenticated user's id, or 0 if none was stored.
+func contextUserID(r *http.Request) int {
+	userID, _ := r.Context().Value(userIDContextKey).(int)
+	return userID
+}
+
+// Return a copy of the request carrying a request-scoped logger.
+func contextSetLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	return contextSet(r, loggerContextKey, logger)
+}
+
+// Return the request-scoped logger, or nil if none was stored.
+func contextLogger(r *http.Request) *slog.Logger {
+	return loggerFromContext(r.Context())
+}
+
+// Return the request-scoped logger stored in ctx, or nil if there is none.
+// Models only get the request's context, not the request itself.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	logger, _ := ctx.Value(loggerContextKey).(*slog.Logger)
+	return logger
+}
+
+// Return a copy of the request carrying the current user's workspace.
+func contextSetWorkspaceID(r *http.Request, workspaceID int) *http.Request {
+	return contextSet(r, workspaceIDContextKey, workspaceID)
+}
+
+// Return the workspace stored for the request. Unset (e.g. anonymous users)
+// means the default workspace.
+func contextWorkspaceID(r *http.Request) int {
+	workspaceID, ok := r.Context().Value(workspaceIDContextKey).(int)
+	if !ok || workspaceID == 0 {
+		return models.DefaultWorkspaceID
+	}
+	return workspaceID
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+func TestContextDefaults(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if contextIsAuthenticated(r) {
+		t.Error("contextIsAuthenticated: got true; want false")
+	}
+	if contextIsAdmin(r) {
+		t.Error("contextIsAdmin: got true; want false")
+	}
+	if got := contextUserID(r); got != 0 {
+		t.Errorf("contextUserID: got %d; want 0", got)
+	}
+	if got := contextLogger(r); got != nil {
+		t.Errorf("contextLogger: got %v; want nil", got)
+	}
+	if got := contextWorkspaceID(r); got != models.DefaultWorkspaceID {
+		t.Errorf("contextWorkspaceID: got %d; want %d", got, models.DefaultWorkspaceID)
+	}
+}
+
+func TestContextRoundTrip(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(nil, nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = contextSetAuthenticated(r, true)
+	r = contextSetAdmin(r, true)
+	r = contextSetUserID(r, 42)
+	r = contextSetLogger(r, logger)
+	r = contextSetWorkspaceID(r, 7)
+
+	if !contextIsAuthenticated(r) {
+		t.Error("contextIsAuthenticated: got false; want true")
+	}
+	if !contextIsAdmin(r) {
+		t.Error("contextIsAdmin: got false; want true")
+	}
+	if got := contextUserID(r); got != 42 {
+		t.Errorf("contextUserID: got %d; want 42", got)
+	}
+	if got := contextLogger(r); got != logger {
+		t.Errorf("contextLogger: got %v; want %v", got, logger)
+	}
+	if got := contextWorkspaceID(r); got != 7 {
+		t.Errorf("contextWorkspaceID: got %d; want 7", got)
+	}
+
+	// Values can be cleared again.
+	r = contextSetAuthenticated(r, false)
+	if contextIsAuthenticated(r) {
+		t.Error("contextIsAuthenticated after clearing: got true; want false")
+	}
+}
+
+func TestContextKeyCollision(t *testing.T) {
+	// A plain string key with the same text doesn't reach our value.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "isAuthenticated", true))
+
+	if contextIsAuthenticated(r) {
+		t.Error("contextIsAuthenticated: got true from a string key; want false")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// How long a single health check ping may take.
+const dbPingTimeout = 5 * time.Second
+
+// The dbMonitor pings the database in the background and keeps a flag saying
+// whether the last ping succeeded, for the readiness check. While the
+// database is down it pings less and less often (doubling up to
+// maxInterval), and goes back to the normal interval once it recovers.
+type dbMonitor struct {
+	ping        func(context.Context) error
+	interval    time.Duration
+	maxInterval time.Duration
+	logger      *slog.Logger
+	healthy     atomic.Bool
+}
+
+// Create a monitor for the given ping function. The database is assumed to
+// be healthy to begin with, as it has just been reached on startup.
+func newDBMonitor(logger *slog.Logger, ping func(context.Context) error, interval, maxInterval time.Duration) *dbMonitor {
+	m := &dbMonitor{ping: ping, interval: interval, maxInterval: max(interval, maxInterval), logger: logger}
+	m.healthy.Store(true)
+	return m
+}
+
+// Healthy reports whether the most recent ping succeeded.
+func (m *dbMonitor) Healthy() bool {
+	return m.healthy.Load()
+}
+
+// Run checks the database until ctx is cancelled.
+func (m *dbMonitor) run(ctx context.Context) {
+	wait := m.interval
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if m.check(ctx) {
+			wait = m.interval
+		} else {
+			wait = min(wait*2, m.maxInterval)
+		}
+
+		timer.Reset(wait)
+	}
+}
+
+// Ping the database once, update the flag and log any change. It returns
+// whether the database is healthy.
+func (m *dbMonitor) check(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+
+	err := m.ping(pingCtx)
+	healthy := err == nil
+
+	if m.healthy.Swap(healthy) != healthy {
+		if healthy {
+			m.logger.Info("database reachable again")
+		} else {
+			m.logger.Error("database unreachable", "error", err.Error())
+		}
+	}
+
+	return healthy
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDBMonitorCheck(t *testing.T) {
+	var logs bytes.Buffer
+	pingErr := errors.New("connection refused")
+
+	var fail bool
+	ping := func(ctx context.Context) error {
+		if fail {
+			return pingErr
+		}
+		return nil
+	}
+
+	m := newDBMonitor(slog.New(slog.NewTextHandler(&logs, nil)), ping, time.Second, time.Minute)
+	if !m.Healthy() {
+		t.Fatal("want a new monitor to start out healthy")
+	}
+
+	tests := []struct {
+		name    string
+		fail    bool
+		wantLog string
+	}{
+		{"Still healthy", false, ""},
+		{"Goes down", true, "database unreachable"},
+		{"Still down", true, ""},
+		{"Recovers", false, "database reachable again"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			fail = tt.fail
+
+			if got := m.check(context.Background()); got != !tt.fail {
+				t.Errorf("got check %t; want %t", got, !tt.fail)
+			}
+			if got := m.Healthy(); got != !tt.fail {
+				t.Errorf("got Healthy %t; want %t", got, !tt.fail)
+			}
+
+			// Only transitions are logged.
+			if tt.wantLog == "" && logs.Len() != 0 {
+				t.Errorf("got log %q; want nothing", logs.String())
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("got log %q; want it to contain %q", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestDBMonitorRun(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		pings int
+	)
+	ping := func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		pings++
+		return errors.New("connection refused")
+	}
+
+	m := newDBMonitor(slog.New(slog.NewTextHandler(io.Discard, nil)), ping, 10*time.Millisecond, 40*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(250 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want run to return once the context is cancelled")
+	}
+
+	if m.Healthy() {
+		t.Error("want the monitor to be unhealthy")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Unbacked off, 250ms at 10ms would be around 25 pings. Doubling to a
+	// 40ms ceiling gives about 10 (10, 20, 40, 40...).
+	if pings < 3 || pings > 15 {
+		t.Errorf("got %d pings; want the interval to back off", pings)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	var fail bool
+	ping := func(ctx context.Context) error {
+		if fail {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	app := newTestApplication(t)
+	app.dbMonitor = newDBMonitor(app.logger, ping, time.Minute, time.Minute)
+	ts := newTestServer(t, app.routes())
+
+	for _, tt := range []struct {
+		fail     bool
+		wantCode int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+		{false, http.StatusOK},
+	} {
+		fail = tt.fail
+		app.dbMonitor.check(context.Background())
+
+		code, _, _ := ts.get(t, "/readyz")
+		if code != tt.wantCode {
+			t.Errorf("with fail %t: got status %d; want %d", tt.fail, code, tt.wantCode)
+		}
+	}
+}
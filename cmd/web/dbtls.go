@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The name the custom CA TLS config is registered with the MySQL driver
+// under, and referenced by from the DSN.
+const dbTLSConfigName = "custom"
+
+// Apply the DB_TLS setting to a DSN. It's one of:
+//
+//   - "" or "false": leave the DSN as it is.
+//   - "true": require TLS, verified against the system root CAs.
+//   - "skip-verify": require TLS without verifying the server certificate.
+//   - a file path: require TLS, verified against the CA certificate(s) in
+//     that PEM file, as hosted providers often use their own CA.
+//
+// The CA file is loaded and registered with the driver once; the returned
+// DSN refers to it by name.
+func dbTLSDSN(dsn, value string) (string, error) {
+	switch value {
+	case "", "false":
+		return dsn, nil
+	case "true", "skip-verify":
+	default:
+		err := registerDBTLSConfig(value)
+		if err != nil {
+			return "", err
+		}
+		value = dbTLSConfigName
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	cfg.TLSConfig = value
+
+	return cfg.FormatDSN(), nil
+}
+
+// Load the CA certificates in caFile and register a TLS config trusting
+// them with the MySQL driver.
+func registerDBTLSConfig(caFile string) error {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("invalid DB_TLS: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("invalid DB_TLS: no certificates found in %q", caFile)
+	}
+
+	// The driver fills in ServerName from the DSN's host.
+	return mysql.RegisterTLSConfig(dbTLSConfigName, &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	})
+}
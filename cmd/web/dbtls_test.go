@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Write a self-signed CA certificate to a PEM file and return its path.
+func writeTestCA(t *testing.T) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestDBTLSDSN(t *testing.T) {
+	const dsn = "web:pass@tcp(db.example.com:3306)/snippetbox?parseTime=true"
+
+	caFile := writeTestCA(t)
+	t.Cleanup(func() { mysql.DeregisterTLSConfig(dbTLSConfigName) })
+
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		value     string
+		wantTLS   string
+		wantError bool
+	}{
+		{name: "Disabled", value: ""},
+		{name: "False", value: "false"},
+		{name: "True", value: "true", wantTLS: "true"},
+		{name: "Skip verify", value: "skip-verify", wantTLS: "skip-verify"},
+		{name: "CA file", value: caFile, wantTLS: dbTLSConfigName},
+		{name: "Missing CA file", value: filepath.Join(t.TempDir(), "missing.pem"), wantError: true},
+		{name: "No certificates", value: notPEM, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dbTLSDSN(dsn, tt.value)
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("got nil error; want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Parsing fails for a config name the driver doesn't know, so
+			// this also checks the CA config was registered.
+			cfg, err := mysql.ParseDSN(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.TLSConfig != tt.wantTLS {
+				t.Errorf("got tls %q; want %q", cfg.TLSConfig, tt.wantTLS)
+			}
+			if cfg.Addr != "db.example.com:3306" || cfg.DBName != "snippetbox" || !cfg.ParseTime {
+				t.Errorf("got DSN %q; want the rest of %q kept", got, dsn)
+			}
+
+			if tt.wantTLS == dbTLSConfigName && (cfg.TLS == nil || cfg.TLS.RootCAs == nil) {
+				t.Error("want the registered config to trust the CA file")
+			}
+		})
+	}
+}
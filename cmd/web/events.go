@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// A snippetEvent is sent to live listeners when a snippet is created.
+type snippetEvent struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	workspaceID int
+}
+
+// The broadcaster fans events out to every subscribed channel. It's in
+// process only, so with several instances each one streams the snippets
+// created through it.
+type broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan snippetEvent]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subscribers: make(map[chan snippetEvent]struct{})}
+}
+
+// Subscribe returns a channel receiving every published event, and a
+// function to call once the subscriber is done with it.
+func (b *broadcaster) Subscribe() (<-chan snippetEvent, func()) {
+	ch := make(chan snippetEvent, 16)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish sends ev to every subscriber. A subscriber whose buffer is full
+// misses the event rather than holding up the publisher.
+func (b *broadcaster) Publish(ev snippetEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Stream new snippets in the user's workspace as Server-Sent Events until
+// the client goes away or the server shuts down.
+func (app *application) events(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// Subscribe before sending the headers, so that a client which acts on
+	// having connected doesn't miss the events that follow.
+	ch, unsubscribe := app.broadcaster.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	err := rc.Flush()
+	if err != nil {
+		app.requestLogger(r).Error("events: streaming unsupported", "error", err.Error())
+		return
+	}
+
+	workspaceID := contextWorkspaceID(r)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.shutdown:
+			return
+		case ev := <-ch:
+			if ev.workspaceID != workspaceID {
+				continue
+			}
+
+			js, err := json.Marshal(ev)
+			if err != nil {
+				app.requestLogger(r).Error("events", "error", err.Error())
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "data: %s\n\n", js)
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models/mocks"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := newBroadcaster()
+
+	ch, unsubscribe := b.Subscribe()
+
+	b.Publish(snippetEvent{ID: 1, Title: "First"})
+
+	select {
+	case ev := <-ch:
+		if ev.ID != 1 || ev.Title != "First" {
+			t.Errorf("got event %+v; want id 1 titled %q", ev, "First")
+		}
+	default:
+		t.Fatal("subscriber got no event")
+	}
+
+	// A full buffer drops events rather than blocking the publisher.
+	for i := 0; i < cap(ch)+1; i++ {
+		b.Publish(snippetEvent{ID: i})
+	}
+	if len(ch) != cap(ch) {
+		t.Errorf("got %d buffered events; want %d", len(ch), cap(ch))
+	}
+
+	unsubscribe()
+
+	b.mu.Lock()
+	subscribers := len(b.subscribers)
+	b.mu.Unlock()
+	if subscribers != 0 {
+		t.Errorf("got %d subscribers after unsubscribing; want 0", subscribers)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rs.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("got Content-Type %q; want %q", got, "text/event-stream")
+	}
+
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets", strings.NewReader(`{"title": "A title", "content": "Some content", "expires": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+mocks.MockAPIToken)
+
+	code, _, body := ts.do(t, req)
+	if code != http.StatusCreated {
+		t.Fatalf("creating a snippet: got status %d; want %d: %s", code, http.StatusCreated, body)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(rs.Body)
+		for scanner.Scan() {
+			if scanner.Text() != "" {
+				lines <- scanner.Text()
+			}
+		}
+		close(lines)
+	}()
+
+	select {
+	case line := <-lines:
+		want := `data: {"id":2,"title":"A title"}`
+		if line != want {
+			t.Errorf("got %q; want %q", line, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	// Disconnecting removes the subscriber.
+	rs.Body.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		app.broadcaster.mu.Lock()
+		subscribers := len(app.broadcaster.subscribers)
+		app.broadcaster.mu.Unlock()
+
+		if subscribers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d subscribers after disconnecting; want 0", subscribers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,36 +1,346 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/joshuagageellis/snippetbox.git/internal/models"
 	"github.com/joshuagageellis/snippetbox.git/internal/validator"
 	"github.com/julienschmidt/httprouter"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/text/unicode/norm"
 )
 
 type snippetCreateForm struct {
+	Title               string   `form:"title"`
+	Content             string   `form:"content"`
+	Expires             int      `form:"expires"`
+	Tags                []string `form:"tags"`
+	SkipDuplicateCheck  bool     `form:"skip_duplicate_check"`
+	validator.Validator `form:"-"`
+}
+
+// TagInputs returns the tags to fill the form's tag inputs with: those
+// submitted, padded with blanks to maxSnippetTags.
+func (f snippetCreateForm) TagInputs() []string {
+	inputs := slices.Clone(f.Tags)
+	for len(inputs) < maxSnippetTags {
+		inputs = append(inputs, "")
+	}
+	return inputs
+}
+
+// The edit form carries the version of the snippet that was loaded, so that
+// a save based on a stale copy can be detected and rejected.
+type snippetEditForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Version             int    `form:"version"`
 	validator.Validator `form:"-"`
 }
 
-func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest(20)
+type userSignupForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+type userLoginForm struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// Validation rules for a new snippet, shared by the web form and the API so
+// both report the same errors.
+func (app *application) validateSnippet(v *validator.Validator, title, content string, expires int) {
+	app.validateSnippetText(v, title, content)
+	v.CheckField(validator.PermittedValue(expires, models.PermittedExpiries...), "expires", "This field must equal "+expiryChoices())
+}
+
+// Validation rules for a snippet's title and content, for both creating and
+// editing. Text which isn't valid UTF-8 would be mangled by the database, so
+// it's rejected.
+func (app *application) validateSnippetText(v *validator.Validator, title, content string) {
+	v.CheckField(validator.NotBlank(title), "title", "This field cannot be blank")
+	v.CheckField(validator.ValidUTF8(title), "title", "This field must be valid UTF-8 text")
+	v.CheckField(validator.MaxChars(title, 100), "title", "This field cannot be more than 100 characters long")
+	v.CheckField(validator.NotBlank(content), "content", "This field cannot be blank")
+	v.CheckField(validator.ValidUTF8(content), "content", "This field must be valid UTF-8 text")
+	app.validateContentSize(v, content)
+}
+
+// The most tags a snippet may have, the longest a tag may be, and the
+// largest index accepted for indexed form fields such as "tags[3]".
+const (
+	maxSnippetTags   = 5
+	maxTagLength     = 20
+	maxFormArraySize = 100
+)
+
+// Tags are single words: letters, numbers, hyphens and underscores. Blank
+// values are let through, since the form always sends every tag input.
+var tagRX = regexp.MustCompile(`^[\p{L}\p{N}_-]*$`)
+
+// Validation rules for a snippet's tags, as submitted. Errors about a single
+// tag are reported against its index (e.g. "tags[2]"), so the form can show
+// them next to the right input.
+func validateTags(v *validator.Validator, tags []string) {
+	v.CheckEach(tags, "tags", func(tag string) bool { return validator.MaxChars(tag, maxTagLength) }, fmt.Sprintf("Tags cannot be more than %d characters long", maxTagLength))
+	v.CheckEach(tags, "tags", func(tag string) bool { return validator.Matches(tag, tagRX) }, "Tags may only contain letters, numbers, hyphens and underscores")
+	v.CheckField(len(compactTags(tags)) <= maxSnippetTags, "tags", fmt.Sprintf("A snippet cannot have more than %d tags", maxSnippetTags))
+}
+
+// Normalize submitted tags in place: trimmed, lower case and NFC. Their
+// positions are kept, so that errors line up with the form inputs.
+func normalizeTags(tags []string) {
+	for i, tag := range tags {
+		tags[i] = normalizeTag(tag)
+	}
+}
+
+// Normalize a single tag: trimmed, lower case and NFC.
+func normalizeTag(tag string) string {
+	return strings.ToLower(normalizeText(strings.TrimSpace(tag)))
+}
+
+// Return the tags to store: the non-blank ones, without repeats, in the
+// order given.
+func compactTags(tags []string) []string {
+	var compacted []string
+	for _, tag := range tags {
+		if tag != "" && !slices.Contains(compacted, tag) {
+			compacted = append(compacted, tag)
+		}
+	}
+	return compacted
+}
+
+// Normalize submitted text to NFC, so that the same characters are always
+// stored the same way whichever form the browser sent them in. Invalid UTF-8
+// is left as it is, for validation to reject.
+func normalizeText(s string) string {
+	return norm.NFC.String(s)
+}
+
+// Snippet content is limited by its size in bytes, since that's what the
+// database column stores, rather than by its length in characters.
+func (app *application) validateContentSize(v *validator.Validator, content string) {
+	v.CheckField(validator.MaxBytes(content, app.maxContentBytes), "content", "This field cannot be larger than "+app.contentLimit())
+}
+
+// Describe the content size limit for error messages.
+func (app *application) contentLimit() string {
+	if app.maxContentBytes%1024 == 0 {
+		return fmt.Sprintf("%d KB", app.maxContentBytes/1024)
+	}
+	return fmt.Sprintf("%d bytes", app.maxContentBytes)
+}
+
+// If the create form came with a file, use its contents as the snippet
+// content and its name as the title when none was given. Problems with the
+// file are reported as field errors on the form.
+func (app *application) readSnippetUpload(r *http.Request, form *snippetCreateForm) error {
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if header.Size > int64(app.maxContentBytes) {
+		form.AddFieldError("file", "This file cannot be larger than "+app.contentLimit())
+		return nil
+	}
+
+	// The file replaces the textarea, so having both is most likely a
+	// mistake. Ask which one was meant rather than dropping the text.
+	if strings.TrimSpace(form.Content) != "" {
+		form.AddFieldError("file", "Either upload a file or enter content, not both")
+		return nil
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, int64(app.maxContentBytes)))
+	if err != nil {
+		return err
+	}
+
+	// Don't trust the type sent by the browser (which is often
+	// application/octet-stream for source files), sniff it instead.
+	if !strings.HasPrefix(http.DetectContentType(content), "text/") || !utf8.Valid(content) {
+		form.AddFieldError("file", "This file must be plain text")
+		return nil
+	}
+
+	form.Content = string(content)
+	if strings.TrimSpace(form.Title) == "" {
+		form.Title = filepath.Base(header.Filename)
+	}
+
+	return nil
+}
+
+// Liveness check. This only confirms that the process is serving requests.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+// Readiness check. Unlike healthz this fails (503) while the database is
+// unreachable, so load balancers can stop sending traffic until it's back.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	if app.dbMonitor != nil && !app.dbMonitor.Healthy() {
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("OK"))
+}
+
+// Report which build is running.
+func (app *application) versionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, getBuildInfo(), nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// How long the status page waits for the database to answer a ping.
+const statusPingTimeout = 2 * time.Second
+
+// Detailed status for admins: database latency and pool statistics, uptime
+// and the number of goroutines. A failed ping is reported in the body rather
+// than failing the request, as it's meant for diagnosis.
+func (app *application) status(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), statusPingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := app.db.PingContext(ctx)
+	latency := time.Since(start)
+
+	database := map[string]any{
+		"ping_ms": float64(latency.Microseconds()) / 1000,
+		"healthy": err == nil,
+		"pool":    app.db.Stats(),
+	}
+	if err != nil {
+		database["error"] = err.Error()
+	}
+
+	uptime := time.Since(app.started)
+
+	data := map[string]any{
+		"version":        getBuildInfo(),
+		"uptime":         uptime.Round(time.Second).String(),
+		"uptime_seconds": int64(uptime.Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"database":       database,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) home(w http.ResponseWriter, r *http.Request) {
+	limit := parseLimit(r.URL.Query().Get("limit"), 20, app.maxListLimit)
+
+	// Unknown sort keys fall back to the default order.
+	sort := r.URL.Query().Get("sort")
+	if !validator.PermittedValue(sort, models.SnippetSorts...) {
+		sort = "newest"
+	}
+
+	// Only snippets with this tag, if given.
+	tag := normalizeTag(r.URL.Query().Get("tag"))
+
+	// Huge page numbers are capped so the offset can't overflow. Pages past
+	// the end are clamped to the last page below, once the total is known.
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	page = min(page, math.MaxInt32/limit)
+
+	filter := models.SnippetFilter{Sort: sort, Tag: tag, Limit: limit, Offset: (page - 1) * limit}
+
+	snippets, total, err := app.workspaceSnippets(r).Query(filter)
+	if err == nil && page > 1 && filter.Offset >= total {
+		page = max(1, (total+limit-1)/limit)
+		filter.Offset = (page - 1) * limit
+		snippets, total, err = app.workspaceSnippets(r).Query(filter)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.Sort = sort
+	data.Tag = tag
+
+	var next, prev string
+	if page*limit < total {
+		data.NextPage = page + 1
+		next = app.pageURL(r, "page", strconv.Itoa(data.NextPage))
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+		prev = app.pageURL(r, "page", strconv.Itoa(data.PrevPage))
+	}
+	setPaginationHeaders(w, total, page, next, prev)
 
 	app.render(w, r, http.StatusOK, "home.tmpl", data)
 }
 
+// Search snippet titles and content. Each result shows an excerpt of the
+// content with the matches highlighted.
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Search = strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if data.Search != "" {
+		limit := parseLimit(r.URL.Query().Get("limit"), 20, app.maxListLimit)
+
+		snippets, total, err := app.workspaceSnippets(r).Query(models.SnippetFilter{Search: data.Search, Limit: limit})
+		if err != nil {
+			if errors.Is(err, models.ErrTimeout) {
+				app.serviceUnavailable(w, r, err)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		data.Snippets = snippets
+		data.SearchTotal = total
+	}
+
+	app.render(w, r, http.StatusOK, "search.tmpl", data)
+}
+
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 
@@ -40,10 +350,15 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
+	// Tag everything logged for this request with the route and snippet.
+	r = app.withLogAttrs(r, "route", "snippetView", "snippet_id", id)
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -52,6 +367,23 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.CanManage = app.canManage(r, snippet)
+	data.LineNumbers = r.URL.Query().Get("lines") == "1"
+
+	data.Tags, err = app.workspaceSnippets(r).Tags(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if app.isAuthenticated(r) {
+		favorites, err := app.workspaceSnippets(r).FavoritesByUser(app.authenticatedUserID(r))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.IsFavorite = slices.ContainsFunc(favorites, func(s models.Snippet) bool { return s.ID == id })
+	}
 
 	app.render(w, r, http.StatusOK, "view.tmpl", data)
 }
@@ -61,12 +393,25 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 
 	// Default values.
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Expires: app.defaultExpiry,
 	}
 
 	app.render(w, r, http.StatusOK, "create.tmpl", data)
 }
 
+// Show the create form again for a submission too large to read, as
+// reported by limitSnippetBody. Nothing of what was sent can be kept.
+func (app *application) snippetTooLarge(w http.ResponseWriter, r *http.Request) {
+	form := snippetCreateForm{
+		Expires: app.defaultExpiry,
+	}
+	form.AddNonFieldError("This snippet is too large. Content and uploaded files cannot be larger than " + app.contentLimit() + ".")
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, http.StatusRequestEntityTooLarge, "create.tmpl", data)
+}
+
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
 	var form snippetCreateForm
 
@@ -76,10 +421,18 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	err = app.readSnippetUpload(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Title = normalizeText(form.Title)
+	form.Content = normalizeText(form.Content)
+	normalizeTags(form.Tags)
+
+	app.validateSnippet(&form.Validator, form.Title, form.Content, form.Expires)
+	validateTags(&form.Validator, form.Tags)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -88,15 +441,1113 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	err = app.checkSnippetQuota(r)
 	if err != nil {
-		app.serverError(w, r, err)
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			form.AddNonFieldError(fmt.Sprintf("You already have %d snippets, the most allowed. Delete some to make room.", app.snippetQuota))
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusForbidden, "create.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Look for an existing snippet with the same title. This only produces a
+	// warning; the snippet is created either way.
+	duplicate := false
+	if !form.SkipDuplicateCheck {
+		duplicate, err = app.workspaceSnippets(r).TitleExists(form.Title)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	id, err := app.workspaceSnippets(r).InsertWithTags(form.Title, form.Content, form.Expires, app.authenticatedUserID(r), compactTags(form.Tags))
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicate) {
+			app.clientError(w, http.StatusConflict)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
+	snippetsCreated.Add(1)
+	app.auditLog(r, models.AuditCreate, id, form.Title)
+	app.broadcaster.Publish(snippetEvent{ID: id, Title: form.Title, workspaceID: contextWorkspaceID(r)})
+
 	// Use the Put() method to add a string value ("Snippet successfully
 	// created!") and the corresponding key ("flash") to the session data.
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	if duplicate {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created! Note: another snippet already has this title.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	}
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Read from the primary, so that a lagging replica can't hand out an old
+	// version to edit (which would only end in a conflict on saving).
+	snippet, err := app.workspaceSnippets(r).GetFromPrimary(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title:   snippet.Title,
+		Content: snippet.Content,
+		Version: snippet.Version,
+	}
+
+	app.render(w, r, http.StatusOK, "edit.tmpl", data)
+}
+
+// Save an edit. Like showing the form, this is for the snippet's owner (or
+// an admin) only.
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).GetFromPrimary(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form snippetEditForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Title = normalizeText(form.Title)
+	form.Content = normalizeText(form.Content)
+
+	app.validateSnippetText(&form.Validator, form.Title, form.Content)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = models.Snippet{ID: id}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl", data)
+		return
+	}
+
+	err = app.workspaceSnippets(r).Update(id, form.Title, form.Content, form.Version)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			// Someone else saved in the meantime. Keep the user's changes in
+			// the form but hand them the latest version so they can retry.
+			current, err := app.workspaceSnippets(r).GetFromPrimary(id)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					app.notFound(w)
+				} else {
+					app.serverError(w, r, err)
+				}
+				return
+			}
+
+			form.Version = current.Version
+			form.AddNonFieldError("This snippet was changed by someone else while you were editing it. Please review and save again.")
+
+			data := app.newTemplateData(r)
+			data.Snippet = current
+			data.Form = form
+			app.render(w, r, http.StatusConflict, "edit.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.auditLog(r, models.AuditUpdate, id, form.Title)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, r, http.StatusOK, "signup.tmpl", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	form.CheckField(validator.StrongPassword(form.Password), "password", "This field must contain letters and at least one number or symbol")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		return
+	}
+
+	_, err = app.users.Insert(form.Name, form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+
+	app.redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, r, http.StatusOK, "login.tmpl", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	var form userLoginForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		return
+	}
+
+	// Refuse to even check the password while this email/IP pair is locked
+	// out after too many failures.
+	lockoutKey := strings.ToLower(form.Email) + "|" + app.realIP(r)
+
+	if locked, retryAfter := app.loginLockout.Locked(lockoutKey); locked {
+		form.AddNonFieldError("Too many failed login attempts. Please try again later.")
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl", data)
+		return
+	}
+
+	id, err := app.users.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.loginLockout.Fail(lockoutKey)
+
+			form.AddNonFieldError("Email or password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Renew the session token whenever the authentication state changes, to
+	// prevent session fixation.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.loginLockout.Reset(lockoutKey)
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+
+	app.redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+
+	app.redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// How long after a delete the user can still undo it. It's a variable so that
+// tests can shorten it.
+var undoDeleteWindow = 30 * time.Second
+
+// Soft delete a snippet. Only its owner (or an admin) may delete it.
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.workspaceSnippets(r).Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.auditLog(r, models.AuditDelete, id, "")
+
+	// Remember what was deleted, and until when it can be undone. The base
+	// template offers an undo button while the window is open. The deadline
+	// is stored in Unix milliseconds, as the session codec can't encode a
+	// time.Time without registering it.
+	app.sessionManager.Put(r.Context(), "undoDeleteID", id)
+	app.sessionManager.Put(r.Context(), "undoDeleteUntil", time.Now().Add(undoDeleteWindow).UnixMilli())
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted.")
+
+	app.redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Only the snippet most recently deleted in this session can be restored,
+	// and only within the undo window. Anything else has gone for good.
+	if app.undoDeleteID(r) != id {
+		app.clientError(w, http.StatusGone)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "undoDeleteID")
+	app.sessionManager.Remove(r.Context(), "undoDeleteUntil")
+
+	err = app.workspaceSnippets(r).Restore(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusGone)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.auditLog(r, models.AuditRestore, id, "")
+	app.sessionManager.Put(r.Context(), "flash", "Snippet restored.")
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetArchivePost(w http.ResponseWriter, r *http.Request) {
+	app.setArchived(w, r, true)
+}
+
+func (app *application) snippetUnarchivePost(w http.ResponseWriter, r *http.Request) {
+	app.setArchived(w, r, false)
+}
+
+// Shared implementation of the archive and unarchive handlers. Only the
+// snippet's owner (or an admin) may change it.
+func (app *application) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.workspaceSnippets(r).SetArchived(id, archived)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if archived {
+		app.auditLog(r, models.AuditArchive, id, "")
+		app.sessionManager.Put(r.Context(), "flash", "Snippet archived.")
+	} else {
+		app.auditLog(r, models.AuditUnarchive, id, "")
+		app.sessionManager.Put(r.Context(), "flash", "Snippet unarchived.")
+	}
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// Serve the bare snippet content as plain text, e.g. for piping into a
+// terminal. With ?dl=1 the browser is asked to download it instead.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if r.URL.Query().Get("dl") == "1" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", models.Slugify(snippet.Title)+".txt"))
+	}
+
+	w.Write([]byte(snippet.Content))
+}
+
+// Permanently remove expired snippets on demand. Clients asking for JSON get
+// the count back in the body, browsers get it in a flash message.
+func (app *application) adminPurgeExpiredPost(w http.ResponseWriter, r *http.Request) {
+	deleted, err := app.workspaceSnippets(r).DeleteExpired()
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		err = app.writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted}, nil)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Purged %d expired snippets.", deleted))
+
+	app.redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// The form on the tag admin page. Renames use From and To, deletes just Tag.
+type adminTagForm struct {
+	From                string `form:"from"`
+	To                  string `form:"to"`
+	Tag                 string `form:"tag"`
+	validator.Validator `form:"-"`
+}
+
+// Check a tag name given on the admin page, the same way snippet tags are
+// checked.
+func checkTagName(form *adminTagForm, tag, key string) {
+	form.CheckField(validator.NotBlank(tag), key, "This field cannot be blank")
+	form.CheckField(validator.MaxChars(tag, maxTagLength), key, fmt.Sprintf("Tags cannot be more than %d characters long", maxTagLength))
+	form.CheckField(validator.Matches(tag, tagRX), key, "Tags may only contain letters, numbers, hyphens and underscores")
+}
+
+// Show the forms for renaming and deleting tags.
+func (app *application) adminTags(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = adminTagForm{}
+
+	app.render(w, r, http.StatusOK, "tags.tmpl", data)
+}
+
+// Rename a tag on every snippet in the workspace, merging it into the new
+// name if that's already in use.
+func (app *application) adminTagRenamePost(w http.ResponseWriter, r *http.Request) {
+	var form adminTagForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.From = normalizeTag(form.From)
+	form.To = normalizeTag(form.To)
+
+	checkTagName(&form, form.From, "from")
+	checkTagName(&form, form.To, "to")
+
+	if form.Valid() {
+		err = app.workspaceSnippets(r).RenameTag(form.From, form.To)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddFieldError("from", "No snippets have this tag")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "tags.tmpl", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Renamed tag %q to %q.", form.From, form.To))
+
+	app.redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// Remove a tag from every snippet in the workspace.
+func (app *application) adminTagDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form adminTagForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Tag = normalizeTag(form.Tag)
+
+	checkTagName(&form, form.Tag, "tag")
+
+	if form.Valid() {
+		err = app.workspaceSnippets(r).DeleteTag(form.Tag)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddFieldError("tag", "No snippets have this tag")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "tags.tmpl", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Deleted tag %q.", form.Tag))
+
+	app.redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+type snippetExtendForm struct {
+	Days int `form:"days"`
+}
+
+// Extend a snippet's expiry by one of the permitted periods. This works on
+// snippets which have expired but not yet been purged too, so ownership is
+// checked with OwnerID rather than Get.
+func (app *application) snippetExtendPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form snippetExtendForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Days, models.PermittedExpiries...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := app.workspaceSnippets(r).OwnerID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, models.Snippet{ID: id, UserID: ownerID}) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.workspaceSnippets(r).ExtendExpiry(id, form.Days)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.auditLog(r, models.AuditExtend, id, fmt.Sprintf("%d days", form.Days))
+	app.sessionManager.Put(r.Context(), "flash", "Snippet expiry extended.")
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// Number of audit log entries per page.
+const auditPageSize = 50
+
+// Show the audit log for the admin's workspace, newest first, a page at a
+// time (?page=N, from 1).
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	// Fetch one extra entry to find out whether there's a further page.
+	entries, err := app.audit.Page(contextWorkspaceID(r), auditPageSize+1, (page-1)*auditPageSize)
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	if len(entries) > auditPageSize {
+		entries = entries[:auditPageSize]
+		data.NextPage = page + 1
+	}
+	data.PrevPage = page - 1
+	data.AuditEntries = entries
+
+	app.render(w, r, http.StatusOK, "audit.tmpl", data)
+}
+
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	validator.Validator `form:"-"`
+}
+
+// Reports from the same IP on the same snippet within this window are
+// counted once.
+const reportDedupeWindow = 24 * time.Hour
+
+// Flag a snippet for the moderators. Anyone may report, but each IP is rate
+// limited, and repeat reports of the same snippet are quietly ignored.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	ip := app.realIP(r)
+
+	allowed, retryAfter, err := app.reportLimiter.Allow(ip)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		app.clientError(w, http.StatusTooManyRequests)
+		return
+	}
+
+	var form snippetReportForm
+
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Reason), "reason", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Reason, 255), "reason", "This field cannot be more than 255 characters long")
+
+	if !form.Valid() {
+		app.sessionManager.Put(r.Context(), "flash", "Please give a reason (up to 255 characters) when reporting a snippet.")
+		app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	// Only live snippets can be reported.
+	_, err = app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	_, err = app.reports.Insert(contextWorkspaceID(r), id, form.Reason, ip, reportDedupeWindow)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, the snippet has been reported.")
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// The moderation queue: open reports in the admin's workspace.
+func (app *application) adminReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := app.reports.Open(contextWorkspaceID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Reports = reports
+
+	app.render(w, r, http.StatusOK, "reports.tmpl", data)
+}
+
+func (app *application) adminReportDismissPost(w http.ResponseWriter, r *http.Request) {
+	app.resolveReports(w, r, false)
+}
+
+func (app *application) adminReportRemovePost(w http.ResponseWriter, r *http.Request) {
+	app.resolveReports(w, r, true)
+}
+
+// Close the reports on a snippet, deleting the snippet first if remove is
+// set.
+func (app *application) resolveReports(w http.ResponseWriter, r *http.Request, remove bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	if remove {
+		err = app.workspaceSnippets(r).Delete(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		if err == nil {
+			app.auditLog(r, models.AuditDelete, id, "removed after report")
+		}
+	}
+
+	err = app.reports.Resolve(contextWorkspaceID(r), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if remove {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet removed.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Reports dismissed.")
+	}
+
+	app.redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+// Hide the current site notice for the rest of the session.
+func (app *application) noticeDismissPost(w http.ResponseWriter, r *http.Request) {
+	notice, _ := app.siteNotice.Load().(string)
+	app.sessionManager.Put(r.Context(), "dismissedNotice", notice)
+
+	app.redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Add a snippet to the user's favorites, or take it off if it's already
+// there.
+func (app *application) snippetFavoritePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	favorite, err := app.workspaceSnippets(r).ToggleFavorite(app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if favorite {
+		app.sessionManager.Put(r.Context(), "flash", "Added to your favorites.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Removed from your favorites.")
+	}
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// List the snippets the user has favorited.
+func (app *application) favorites(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.workspaceSnippets(r).FavoritesByUser(app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "favorites.tmpl", data)
+}
+
+// Show the page for managing the user's API tokens.
+func (app *application) userTokens(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "tokens.tmpl", app.newTemplateData(r))
+}
+
+// Create an API token for the user. Only its hash is kept, so the token
+// itself is shown once, in the flash message.
+func (app *application) userTokensPost(w http.ResponseWriter, r *http.Request) {
+	token, err := app.users.NewAPIToken(app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your new API token is "+token+" - copy it now, it won't be shown again.")
+
+	app.redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+// Revoke all of the user's API tokens.
+func (app *application) userTokensRevokePost(w http.ResponseWriter, r *http.Request) {
+	err := app.users.RevokeAPITokens(app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your API tokens have been revoked.")
+
+	app.redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+// Create a time-limited link to a snippet which works for anyone, logged in
+// or not. Only those who can manage the snippet may share it.
+func (app *application) snippetSharePost(w http.ResponseWriter, r *http.Request) {
+	if app.shareSecret == nil {
+		app.notFound(w)
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	token := models.SignShareLink(app.shareSecret, models.ShareLink{
+		WorkspaceID: contextWorkspaceID(r),
+		SnippetID:   id,
+		Expires:     time.Now().Add(app.shareLinkTTL),
+	})
+
+	link := app.siteURL(r) + "/share?token=" + url.QueryEscape(token)
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Share link, valid for %s: %s", app.shareLinkTTL, link))
+
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// Show the snippet a share link points to. Bad, tampered and expired links
+// all get a plain 404, so they give nothing away.
+func (app *application) share(w http.ResponseWriter, r *http.Request) {
+	if app.shareSecret == nil {
+		app.notFound(w)
+		return
+	}
+
+	link, err := models.VerifyShareLink(app.shareSecret, r.URL.Query().Get("token"), time.Now())
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.ForWorkspace(link.WorkspaceID).WithContext(r.Context()).Get(link.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	app.render(w, r, http.StatusOK, "view.tmpl", data)
+}
+
+// Show a unified diff of a snippet's content between two of its versions,
+// given as ?from= and ?to=. By default the current version is compared with
+// the one before it. Only those who can manage the snippet see its history.
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.workspaceSnippets(r).Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canManage(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	versions, err := app.workspaceSnippets(r).Versions(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	to := versions[len(versions)-1].Version
+	from := max(to-1, versions[0].Version)
+
+	qs := r.URL.Query()
+
+	if value := qs.Get("from"); value != "" {
+		from, err = strconv.Atoi(value)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if value := qs.Get("to"); value != "" {
+		to, err = strconv.Atoi(value)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Find the content of both versions. History can have gaps (e.g. from
+	// before it was recorded), so a version may legitimately be missing.
+	var fromVersion, toVersion *models.SnippetVersion
+	for i := range versions {
+		if versions[i].Version == from {
+			fromVersion = &versions[i]
+		}
+		if versions[i].Version == to {
+			toVersion = &versions[i]
+		}
+	}
+
+	if fromVersion == nil || toVersion == nil {
+		app.notFound(w)
+		return
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fromVersion.Content),
+		B:        difflib.SplitLines(toVersion.Content),
+		FromFile: fmt.Sprintf("version %d", from),
+		ToFile:   fmt.Sprintf("version %d", to),
+		Context:  3,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Versions = versions
+	data.Diff = diff
+	data.DiffFrom = from
+	data.DiffTo = to
+
+	app.render(w, r, http.StatusOK, "diff.tmpl", data)
+}
+
+// Send the user to a snippet picked at random.
+func (app *application) snippetRandom(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.workspaceSnippets(r).Random()
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else if errors.Is(err, models.ErrTimeout) {
+			app.serviceUnavailable(w, r, err)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	app.redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusFound)
 }
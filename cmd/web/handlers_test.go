@@ -0,0 +1,1325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/joshuagageellis/snippetbox.git/internal/models/mocks"
+	"github.com/joshuagageellis/snippetbox.git/internal/validator"
+)
+
+func TestHome(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, headers, body := ts.get(t, "/")
+
+	if code != http.StatusOK {
+		t.Errorf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	// The response passed through the standard and dynamic chains.
+	if got := headers.Get("X-Frame-Options"); got != "deny" {
+		t.Errorf("got X-Frame-Options %q; want %q", got, "deny")
+	}
+	if got := headers.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("got Cache-Control %q; want %q", got, "no-store")
+	}
+
+	if !strings.Contains(body, "An old silent pond") {
+		t.Errorf("want body to contain the mock snippet's title")
+	}
+}
+
+func TestHomeSort(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	// Unknown sort keys, injection attempts included, fall back to the
+	// default order rather than reaching the model.
+	for _, sort := range []string{"newest", "oldest", "title", "bogus", "id;DROP TABLE snippets"} {
+		code, _, body := ts.get(t, "/?sort="+url.QueryEscape(sort))
+
+		if code != http.StatusOK {
+			t.Errorf("sort %q: got status %d; want %d", sort, code, http.StatusOK)
+		}
+		if !strings.Contains(body, "An old silent pond") {
+			t.Errorf("sort %q: want body to contain the mock snippet's title", sort)
+		}
+	}
+}
+
+func TestSnippetView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  "/snippet/view/1",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond...",
+		},
+		{
+			name:     "Line numbers on",
+			urlPath:  "/snippet/view/1?lines=1",
+			wantCode: http.StatusOK,
+			wantBody: "<td class='number'>1</td>",
+		},
+		{
+			name:     "Line numbers off",
+			urlPath:  "/snippet/view/1",
+			wantCode: http.StatusOK,
+			wantBody: "?lines=1'>Line numbers</a>",
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/view/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Negative ID",
+			urlPath:  "/snippet/view/-1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/snippet/view/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+
+			if tt.wantBody != "" && !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody string
+	}{
+		{"No query", "/search", "Search Snippets"},
+		{"Match", "/search?q=SILENT", "An old <mark>silent</mark> pond..."},
+		{"No match", "/search?q=toad", "No snippets match your search."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			if code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", code, http.StatusOK)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetCreateAudit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+
+	form := url.Values{}
+	form.Add("title", "A new noisy pond")
+	form.Add("content", "A frog jumps into the pond")
+	form.Add("expires", "7")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/snippet/create", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+	}
+
+	entries, err := app.audit.Page(models.DefaultWorkspaceID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries; want 1", len(entries))
+	}
+
+	want := models.AuditEntry{ID: 1, WorkspaceID: models.DefaultWorkspaceID, UserID: 1, SnippetID: 2, Action: models.AuditCreate, Detail: "A new noisy pond", IP: "127.0.0.1"}
+	if entries[0] != want {
+		t.Errorf("got audit entry %+v; want %+v", entries[0], want)
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Already NFC", "café", "café"},
+		{"Decomposed", "cafe\u0301", "caf\u00e9"},
+		{"ASCII", "An old silent pond", "An old silent pond"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeText(tt.value); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostUTF8(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		content   string
+		wantCode  int
+		wantTitle string
+	}{
+		{"Valid", "古池や", "蛙飛び込む水の音", http.StatusSeeOther, "古池や"},
+		{"Decomposed title", "Cafe\u0301 haiku", "A frog jumps", http.StatusSeeOther, "Caf\u00e9 haiku"},
+		{"Invalid title", "bad \xff title", "A frog jumps", http.StatusUnprocessableEntity, ""},
+		{"Invalid content", "A title", "bad \xe6\x97 content", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			_, _, body := ts.get(t, "/snippet/create")
+
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", tt.content)
+			form.Add("expires", "7")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+
+			if tt.wantCode != http.StatusSeeOther {
+				if !strings.Contains(body, "This field must be valid UTF-8 text") {
+					t.Error("want body to contain the UTF-8 field error")
+				}
+				return
+			}
+
+			snippet, err := app.snippets.Get(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snippet.Title != tt.wantTitle {
+				t.Errorf("got title %q; want %q", snippet.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostConfiguredExpiries(t *testing.T) {
+	permitted := models.PermittedExpiries
+	models.PermittedExpiries = []int{3, 30}
+	t.Cleanup(func() { models.PermittedExpiries = permitted })
+
+	app := newTestApplication(t)
+	app.defaultExpiry = 30
+	ts := newTestServer(t, app.routes())
+
+	_, _, body := ts.get(t, "/snippet/create")
+
+	// The form offers exactly the configured values.
+	for _, days := range []string{"3", "30"} {
+		if !strings.Contains(body, "value='"+days+"'") {
+			t.Errorf("want an option for %s days", days)
+		}
+	}
+	for _, days := range []string{"1", "7", "365"} {
+		if strings.Contains(body, "name='expires' value='"+days+"'") {
+			t.Errorf("want no option for %s days", days)
+		}
+	}
+
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		expires  string
+		wantCode int
+	}{
+		{"3", http.StatusSeeOther},
+		{"30", http.StatusSeeOther},
+		{"1", http.StatusUnprocessableEntity},
+		{"7", http.StatusUnprocessableEntity},
+		{"365", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expires, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "An old silent pond")
+			form.Add("content", "A frog jumps into the pond")
+			form.Add("expires", tt.expires)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if code == http.StatusUnprocessableEntity && !strings.Contains(body, "This field must equal 3 or 30") {
+				t.Error("want body to list the configured expiries")
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostDuplicateTitle(t *testing.T) {
+	tests := []struct {
+		name          string
+		title         string
+		skipCheck     bool
+		wantDuplicate bool
+	}{
+		{"Same title", "An old silent pond", false, true},
+		{"Different case", "AN OLD Silent Pond", false, true},
+		{"Extra whitespace", "  An old silent pond\t", false, true},
+		{"Different title", "A new noisy pond", false, false},
+		{"Check skipped", "An old silent pond", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			_, _, body := ts.get(t, "/snippet/create")
+
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "A frog jumps into the pond")
+			form.Add("expires", "7")
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			if tt.skipCheck {
+				form.Add("skip_duplicate_check", "true")
+			}
+
+			// The snippet is created either way.
+			code, _, _ := ts.postForm(t, "/snippet/create", form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+			}
+
+			// The warning is flashed on the next page.
+			_, _, body = ts.get(t, "/")
+			if !strings.Contains(body, "Snippet successfully created!") {
+				t.Fatal("want body to contain the flash message")
+			}
+			if got := strings.Contains(body, "another snippet already has this title"); got != tt.wantDuplicate {
+				t.Errorf("got duplicate warning %t; want %t", got, tt.wantDuplicate)
+			}
+		})
+	}
+}
+
+func TestSnippetRestorePost(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   time.Duration
+		restore  string
+		wantCode int
+	}{
+		{"Within the window", time.Minute, "/snippet/restore/1", http.StatusSeeOther},
+		{"Window expired", time.Millisecond, "/snippet/restore/1", http.StatusGone},
+		{"Not the deleted snippet", time.Minute, "/snippet/restore/2", http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(window time.Duration) { undoDeleteWindow = window }(undoDeleteWindow)
+			undoDeleteWindow = tt.window
+
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			ts.login(t)
+
+			_, _, body := ts.get(t, "/snippet/view/1")
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := ts.postForm(t, "/snippet/delete/1", form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("deleting: got status %d; want %d", code, http.StatusSeeOther)
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			code, _, _ = ts.postForm(t, tt.restore, form)
+			if code != tt.wantCode {
+				t.Errorf("restoring: got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  "/snippet/raw/1",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond...",
+		},
+		{
+			name:            "Download",
+			urlPath:         "/snippet/raw/1?dl=1",
+			wantCode:        http.StatusOK,
+			wantBody:        "An old silent pond...",
+			wantDisposition: `attachment; filename="an-old-silent-pond.txt"`,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/raw/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Negative ID",
+			urlPath:  "/snippet/raw/-1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/snippet/raw/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			if got := headers.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Errorf("got Content-Type %q; want %q", got, "text/plain; charset=utf-8")
+			}
+			if body != tt.wantBody {
+				t.Errorf("got body %q; want %q", body, tt.wantBody)
+			}
+			if got := headers.Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("got Content-Disposition %q; want %q", got, tt.wantDisposition)
+			}
+		})
+	}
+}
+
+func TestValidateContentSize(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{name: "Under the limit", content: strings.Repeat("a", 65534), valid: true},
+		{name: "At the limit", content: strings.Repeat("a", 65535), valid: true},
+		{name: "Over the limit", content: strings.Repeat("a", 65536), valid: false},
+		// Two bytes per character: under the limit in characters, but not
+		// in bytes.
+		{name: "Multi-byte at the limit", content: strings.Repeat("é", 32767) + "a", valid: true},
+		{name: "Multi-byte over the limit", content: strings.Repeat("é", 32768), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator.Validator
+			app.validateContentSize(&v, tt.content)
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got valid %t; want %t (errors %v)", v.Valid(), tt.valid, v.FieldErrors)
+			}
+			if !tt.valid && v.FieldErrors["content"] != "This field cannot be larger than 65535 bytes" {
+				t.Errorf("got content error %q", v.FieldErrors["content"])
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		filename string
+		file     []byte
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid upload",
+			filename: "haiku.txt",
+			file:     []byte("An old silent pond\nA frog jumps into the pond\nSplash! Silence again."),
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Binary file",
+			filename: "image.png",
+			file:     []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This file must be plain text",
+		},
+		{
+			name:     "File over the content limit",
+			filename: "big.txt",
+			file:     bytes.Repeat([]byte("a"), 1025),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This file cannot be larger than 1 KB",
+		},
+		{
+			name:     "File and content",
+			content:  "Typed in the textarea",
+			filename: "haiku.txt",
+			file:     []byte("An old silent pond"),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Either upload a file or enter content, not both",
+		},
+		{
+			name:     "Body over the limit",
+			filename: "huge.txt",
+			file:     bytes.Repeat([]byte("a"), 2<<20),
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantBody: "This snippet is too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.maxContentBytes = 1024
+			ts := newTestServer(t, app.routes())
+
+			_, _, body := ts.get(t, "/snippet/create")
+
+			var buf bytes.Buffer
+			mw := multipart.NewWriter(&buf)
+			mw.WriteField("csrf_token", extractCSRFToken(t, body))
+			mw.WriteField("content", tt.content)
+			mw.WriteField("expires", "7")
+			fw, err := mw.CreateFormFile("file", tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(tt.file)
+			mw.Close()
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/snippet/create", &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			code, headers, body := ts.do(t, req)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusSeeOther {
+				if got := headers.Get("Location"); got != "/snippet/view/2" {
+					t.Errorf("got Location %q; want %q", got, "/snippet/view/2")
+				}
+				return
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAdminPurgeExpiredPost(t *testing.T) {
+	tests := []struct {
+		name         string
+		login        bool
+		admin        bool
+		accept       string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Anonymous",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:     "Not an admin",
+			login:    true,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Admin JSON",
+			login:    true,
+			admin:    true,
+			accept:   "application/json",
+			wantCode: http.StatusOK,
+			wantBody: `"deleted": 2`,
+		},
+		{
+			name:         "Admin form",
+			login:        true,
+			admin:        true,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			if tt.login {
+				ts.login(t)
+			}
+			if tt.admin {
+				app.users.SetAdmin(1, true)
+			}
+
+			_, _, body := ts.get(t, "/snippet/create")
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/admin/snippets/purge-expired", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			code, headers, body := ts.do(t, req)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := headers.Get("Location"); got != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", got, tt.wantLocation)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("got body %q; want it to contain %q", body, tt.wantBody)
+			}
+
+			// The count is flashed on the page redirected to.
+			if tt.admin && tt.accept == "" {
+				_, _, body = ts.get(t, "/")
+				if !strings.Contains(body, "Purged 2 expired snippets.") {
+					t.Error("want body to contain the purge count")
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetExtendPost(t *testing.T) {
+	tests := []struct {
+		name         string
+		login        bool
+		urlPath      string
+		days         string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Owner",
+			login:        true,
+			urlPath:      "/snippet/extend/1",
+			days:         "7",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/1",
+		},
+		{
+			name:     "Days not permitted",
+			login:    true,
+			urlPath:  "/snippet/extend/1",
+			days:     "9999",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Non-existent ID",
+			login:    true,
+			urlPath:  "/snippet/extend/3",
+			days:     "7",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Anonymous",
+			urlPath:      "/snippet/extend/1",
+			days:         "7",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			if tt.login {
+				ts.login(t)
+			}
+
+			_, _, body := ts.get(t, "/snippet/create")
+
+			form := url.Values{}
+			form.Add("days", tt.days)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := headers.Get("Location"); got != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestSnippetReportPost(t *testing.T) {
+	tests := []struct {
+		name         string
+		urlPath      string
+		reason       string
+		wantCode     int
+		wantLocation string
+		wantReports  int
+	}{
+		{
+			name:         "Valid report",
+			urlPath:      "/snippet/report/1",
+			reason:       "Spam",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/1",
+			wantReports:  1,
+		},
+		{
+			name:         "Blank reason",
+			urlPath:      "/snippet/report/1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/1",
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/snippet/report/99",
+			reason:   "Spam",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			_, _, body := ts.get(t, "/snippet/create")
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+			form.Add("reason", tt.reason)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := headers.Get("Location"); got != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", got, tt.wantLocation)
+			}
+
+			reports, err := app.reports.Open(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reports) != tt.wantReports {
+				t.Errorf("got %d open reports; want %d", len(reports), tt.wantReports)
+			}
+		})
+	}
+}
+
+func TestAdminReports(t *testing.T) {
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantFlash string
+	}{
+		{
+			name:      "Dismiss",
+			urlPath:   "/admin/reports/dismiss/1",
+			wantFlash: "Reports dismissed.",
+		},
+		{
+			name:      "Remove",
+			urlPath:   "/admin/reports/remove/1",
+			wantFlash: "Snippet removed.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			_, err := app.reports.Insert(1, 1, "Off-topic rant", "192.0.2.1", reportDedupeWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ts.login(t)
+			app.users.SetAdmin(1, true)
+
+			code, _, body := ts.get(t, "/admin/reports")
+			if code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", code, http.StatusOK)
+			}
+			if !strings.Contains(body, "Off-topic rant") {
+				t.Error("want body to list the open report")
+			}
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+			}
+			if got := headers.Get("Location"); got != "/admin/reports" {
+				t.Errorf("got Location %q; want %q", got, "/admin/reports")
+			}
+
+			_, _, body = ts.get(t, "/admin/reports")
+			if !strings.Contains(body, tt.wantFlash) {
+				t.Errorf("want body to contain %q", tt.wantFlash)
+			}
+			if strings.Contains(body, "Off-topic rant") {
+				t.Error("want the resolved report to be gone")
+			}
+		})
+	}
+}
+
+func TestSiteNotice(t *testing.T) {
+	const notice = "Scheduled maintenance on Sunday"
+
+	app := newTestApplication(t)
+	app.siteNotice.Store(notice)
+	ts := newTestServer(t, app.routes())
+
+	_, _, body := ts.get(t, "/")
+	if !strings.Contains(body, notice) {
+		t.Fatal("want body to contain the site notice")
+	}
+
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, headers, _ := ts.postForm(t, "/notice/dismiss", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+	}
+	if got := headers.Get("Location"); got != "/" {
+		t.Errorf("got Location %q; want %q", got, "/")
+	}
+
+	_, _, body = ts.get(t, "/")
+	if strings.Contains(body, notice) {
+		t.Error("want the dismissed notice to be hidden")
+	}
+
+	// A new notice shows up again in the same session.
+	app.siteNotice.Store("Maintenance moved to Monday")
+
+	_, _, body = ts.get(t, "/")
+	if !strings.Contains(body, "Maintenance moved to Monday") {
+		t.Error("want body to contain the new site notice")
+	}
+
+	// And a session that never dismissed it still sees it.
+	app.siteNotice.Store(notice)
+	other := newTestServer(t, app.routes())
+
+	_, _, body = other.get(t, "/")
+	if !strings.Contains(body, notice) {
+		t.Error("want a fresh session to see the notice")
+	}
+}
+
+func TestSnippetFavoritePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	// Anonymous users are sent to log in.
+	code, headers, _ := ts.get(t, "/favorites")
+	if code != http.StatusSeeOther || headers.Get("Location") != "/user/login" {
+		t.Fatalf("got status %d, Location %q; want a redirect to /user/login", code, headers.Get("Location"))
+	}
+
+	ts.login(t)
+
+	toggle := func(urlPath string) (int, string) {
+		t.Helper()
+
+		_, _, body := ts.get(t, "/snippet/create")
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, headers, _ := ts.postForm(t, urlPath, form)
+		return code, headers.Get("Location")
+	}
+
+	code, location := toggle("/snippet/favorite/1")
+	if code != http.StatusSeeOther || location != "/snippet/view/1" {
+		t.Fatalf("got status %d, Location %q; want a redirect to /snippet/view/1", code, location)
+	}
+
+	_, _, body := ts.get(t, "/favorites")
+	if !strings.Contains(body, "Added to your favorites.") {
+		t.Error("want body to contain the added flash")
+	}
+	if !strings.Contains(body, "An old silent pond") {
+		t.Error("want the favorited snippet to be listed")
+	}
+
+	toggle("/snippet/favorite/1")
+
+	_, _, body = ts.get(t, "/favorites")
+	if !strings.Contains(body, "Removed from your favorites.") {
+		t.Error("want body to contain the removed flash")
+	}
+	if strings.Contains(body, "An old silent pond") {
+		t.Error("want the unfavorited snippet not to be listed")
+	}
+
+	code, _ = toggle("/snippet/favorite/99")
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d for a missing snippet; want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestSnippetDiff(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	// Anonymous users are sent to log in.
+	code, headers, _ := ts.get(t, "/snippet/diff/1")
+	if code != http.StatusSeeOther || headers.Get("Location") != "/user/login" {
+		t.Fatalf("got status %d, Location %q; want a redirect to /user/login", code, headers.Get("Location"))
+	}
+
+	ts.login(t)
+
+	err := app.snippets.Update(1, "An old silent pond", "A still, silent pond...\nA frog jumps into the pond,\n", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Latest change",
+			urlPath:  "/snippet/diff/1",
+			wantCode: http.StatusOK,
+			wantBody: []string{"--- version 1", "+++ version 2", "-An old silent pond...", "+A still, silent pond...", "+A frog jumps into the pond,"},
+		},
+		{
+			name:     "Same version",
+			urlPath:  "/snippet/diff/1?from=2&to=2",
+			wantCode: http.StatusOK,
+			wantBody: []string{"The content is the same in both versions."},
+		},
+		{
+			name:     "Missing version",
+			urlPath:  "/snippet/diff/1?from=1&to=9",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid version",
+			urlPath:  "/snippet/diff/1?from=abc",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Missing snippet",
+			urlPath:  "/snippet/diff/99",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(html.UnescapeString(body), want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		urlPath   string
+		form      url.Values
+		wantCode  int
+		wantFlash string
+		wantError string
+		wantTags  []string
+	}{
+		{
+			name:      "Rename",
+			urlPath:   "/admin/tags/rename",
+			form:      url.Values{"from": {"golang"}, "to": {"Lang"}},
+			wantCode:  http.StatusSeeOther,
+			wantFlash: `Renamed tag "golang" to "lang".`,
+			wantTags:  []string{"lang", "sql"},
+		},
+		{
+			name:      "Rename with merge",
+			urlPath:   "/admin/tags/rename",
+			form:      url.Values{"from": {"golang"}, "to": {"sql"}},
+			wantCode:  http.StatusSeeOther,
+			wantFlash: `Renamed tag "golang" to "sql".`,
+			wantTags:  []string{"sql"},
+		},
+		{
+			name:      "Rename unused tag",
+			urlPath:   "/admin/tags/rename",
+			form:      url.Values{"from": {"rust"}, "to": {"go"}},
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "No snippets have this tag",
+			wantTags:  []string{"golang", "sql"},
+		},
+		{
+			name:      "Rename to invalid name",
+			urlPath:   "/admin/tags/rename",
+			form:      url.Values{"from": {"golang"}, "to": {"two words"}},
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "Tags may only contain letters, numbers, hyphens and underscores",
+			wantTags:  []string{"golang", "sql"},
+		},
+		{
+			name:      "Delete",
+			urlPath:   "/admin/tags/delete",
+			form:      url.Values{"tag": {"golang"}},
+			wantCode:  http.StatusSeeOther,
+			wantFlash: `Deleted tag "golang".`,
+			wantTags:  []string{"sql"},
+		},
+		{
+			name:      "Delete blank",
+			urlPath:   "/admin/tags/delete",
+			form:      url.Values{"tag": {" "}},
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "This field cannot be blank",
+			wantTags:  []string{"golang", "sql"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			id, err := app.snippets.InsertWithTags("Tagged", "Content", 7, 1, []string{"golang", "sql"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ts.login(t)
+			app.users.SetAdmin(1, true)
+
+			code, _, body := ts.get(t, "/admin/tags")
+			if code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", code, http.StatusOK)
+			}
+
+			tt.form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, body := ts.postForm(t, tt.urlPath, tt.form)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if tt.wantError != "" && !strings.Contains(body, tt.wantError) {
+				t.Errorf("want body to contain %q", tt.wantError)
+			}
+			if tt.wantFlash != "" {
+				if got := headers.Get("Location"); got != "/admin/tags" {
+					t.Errorf("got Location %q; want %q", got, "/admin/tags")
+				}
+
+				_, _, body = ts.get(t, "/admin/tags")
+				if !strings.Contains(html.UnescapeString(body), tt.wantFlash) {
+					t.Errorf("want body to contain %q", tt.wantFlash)
+				}
+			}
+
+			tags, err := app.snippets.Tags(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(tags, tt.wantTags) {
+				t.Errorf("got tags %q; want %q", tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+// A snippet model with nothing to pick at random.
+type emptyRandomSnippetModel struct {
+	*mocks.SnippetModel
+}
+
+func (m emptyRandomSnippetModel) Random() (models.Snippet, error) {
+	return models.Snippet{}, models.ErrNoRecord
+}
+
+func (m emptyRandomSnippetModel) ForWorkspace(int) models.SnippetModelInterface { return m }
+
+func (m emptyRandomSnippetModel) WithContext(context.Context) models.SnippetModelInterface { return m }
+
+func TestSnippetRandom(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, headers, _ := ts.get(t, "/snippet/random")
+	if code != http.StatusFound {
+		t.Fatalf("got status %d; want %d", code, http.StatusFound)
+	}
+	if got := headers.Get("Location"); got != "/snippet/view/1" {
+		t.Errorf("got Location %q; want %q", got, "/snippet/view/1")
+	}
+
+	app.snippets = emptyRandomSnippetModel{&mocks.SnippetModel{}}
+	ts = newTestServer(t, app.routes())
+
+	code, _, _ = ts.get(t, "/snippet/random")
+	if code != http.StatusNotFound {
+		t.Errorf("with no snippets got status %d; want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestHomeTag(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	id, err := app.snippets.InsertWithTags("Tagged", "Content", 7, 1, []string{"haiku"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tags on a snippet link to the listing of that tag.
+	_, _, body := ts.get(t, fmt.Sprintf("/snippet/view/%d", id))
+	if !strings.Contains(body, "href='/?tag=haiku'") {
+		t.Error("want the snippet's tag to link to its listing")
+	}
+
+	_, _, body = ts.get(t, "/?tag=+Haiku+")
+	if !strings.Contains(body, "Snippets Tagged haiku") {
+		t.Error("want the heading to name the normalized tag")
+	}
+	if !strings.Contains(body, "href='/?sort=oldest&tag=haiku'") {
+		t.Error("want the sort links to keep the tag")
+	}
+
+	_, _, body = ts.get(t, "/")
+	if !strings.Contains(body, "Latest Snippets") {
+		t.Error("want the plain heading without a tag")
+	}
+}
+
+// A snippet model whose listing has n snippets, titled "Snippet 1" to
+// "Snippet n", paged by the filter's offset and limit.
+type pagingSnippetModel struct {
+	*mocks.SnippetModel
+	n int
+}
+
+func (m pagingSnippetModel) Query(f models.SnippetFilter) ([]models.Snippet, int, error) {
+	var snippets []models.Snippet
+	for i := f.Offset + 1; i <= min(m.n, f.Offset+f.Limit); i++ {
+		snippets = append(snippets, models.Snippet{ID: i, Title: fmt.Sprintf("Snippet %d", i)})
+	}
+	return snippets, m.n, nil
+}
+
+func (m pagingSnippetModel) ForWorkspace(int) models.SnippetModelInterface { return m }
+
+func (m pagingSnippetModel) WithContext(context.Context) models.SnippetModelInterface { return m }
+
+func TestHomePagination(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippets = pagingSnippetModel{SnippetModel: &mocks.SnippetModel{}, n: 5}
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name      string
+		page      string
+		wantPage  string
+		wantLink  string
+		wantTitle string
+	}{
+		{"First", "1", "1", `</?limit=2&page=2>; rel="next"`, "Snippet 1"},
+		{"Middle", "2", "2", `</?limit=2&page=3>; rel="next", </?limit=2&page=1>; rel="prev"`, "Snippet 3"},
+		{"Last", "3", "3", `</?limit=2&page=2>; rel="prev"`, "Snippet 5"},
+		{"Past the end", "99", "3", `</?limit=2&page=2>; rel="prev"`, "Snippet 5"},
+		{"Max int", "9223372036854775807", "3", `</?limit=2&page=2>; rel="prev"`, "Snippet 5"},
+		{"Overflowing", "99999999999999999999", "1", `</?limit=2&page=2>; rel="next"`, "Snippet 1"},
+		{"Negative", "-1", "1", `</?limit=2&page=2>; rel="next"`, "Snippet 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, "/?limit=2&page="+tt.page)
+			if code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", code, http.StatusOK)
+			}
+
+			if got := headers.Get("X-Total-Count"); got != "5" {
+				t.Errorf("got X-Total-Count %q; want %q", got, "5")
+			}
+			if got := headers.Get("X-Page"); got != tt.wantPage {
+				t.Errorf("got X-Page %q; want %q", got, tt.wantPage)
+			}
+			if got := headers.Get("Link"); got != tt.wantLink {
+				t.Errorf("got Link %q; want %q", got, tt.wantLink)
+			}
+			if !strings.Contains(body, tt.wantTitle) {
+				t.Errorf("want body to contain %q", tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Nothing listens on port 1, so the ping fails fast and the status
+	// reports it.
+	db, err := sql.Open("mysql", "web:pass@tcp(127.0.0.1:1)/snippetbox?timeout=100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	app.db = db
+
+	ts := newTestServer(t, app.routes())
+	ts.login(t)
+
+	code, _, _ := ts.get(t, "/status")
+	if code != http.StatusForbidden {
+		t.Fatalf("not an admin: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	app.users.SetAdmin(1, true)
+
+	code, headers, body := ts.get(t, "/status")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if got := headers.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/json")
+	}
+
+	var status struct {
+		Version       map[string]any `json:"version"`
+		Uptime        string         `json:"uptime"`
+		UptimeSeconds *int64         `json:"uptime_seconds"`
+		Goroutines    int            `json:"goroutines"`
+		Database      struct {
+			PingMS  *float64       `json:"ping_ms"`
+			Healthy *bool          `json:"healthy"`
+			Pool    map[string]any `json:"pool"`
+			Error   string         `json:"error"`
+		} `json:"database"`
+	}
+	err = json.Unmarshal([]byte(body), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Version == nil || status.Uptime == "" || status.UptimeSeconds == nil || *status.UptimeSeconds < 0 {
+		t.Errorf("got version %v, uptime %q; want both set", status.Version, status.Uptime)
+	}
+	if status.Goroutines < 1 {
+		t.Errorf("got %d goroutines; want at least 1", status.Goroutines)
+	}
+	if status.Database.PingMS == nil || *status.Database.PingMS < 0 {
+		t.Errorf("got ping_ms %v; want a non-negative number", status.Database.PingMS)
+	}
+	if status.Database.Healthy == nil || *status.Database.Healthy {
+		t.Errorf("got healthy %v; want false", status.Database.Healthy)
+	}
+	if status.Database.Error == "" {
+		t.Error("want the ping error to be reported")
+	}
+	if _, ok := status.Database.Pool["MaxOpenConnections"]; !ok {
+		t.Errorf("got pool %v; want the pool stats", status.Database.Pool)
+	}
+}
@@ -2,17 +2,22 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"reflect"
 	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
 	"github.com/joho/godotenv"
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/justinas/nosurf"
 )
 
 // The serverError helper writes a log entry at Error level (including the request
@@ -27,7 +32,7 @@ func (app *application) serverError(w http.ResponseWriter, r *http.Request, err
 		trace = string(debug.Stack())
 	)
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
+	app.requestLogger(r).Error(err.Error(), "method", method, "uri", uri, "trace", trace)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
@@ -38,6 +43,14 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// The serviceUnavailable helper is used when a dependency (like the database)
+// didn't answer in time. It logs at Warn level, since this isn't a bug in our
+// code, and sends a 503 Service Unavailable response.
+func (app *application) serviceUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r).Warn(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.clientError(w, http.StatusServiceUnavailable)
+}
+
 // For consistency, we'll also implement a notFound helper. This is simply a
 // convenience wrapper around clientError which sends a 404 Not Found response to
 // the user.
@@ -47,7 +60,8 @@ func (app *application) notFound(w http.ResponseWriter) {
 
 // Load env.
 // Add additional env vars to Env struct.
-// Will populate Env struct with env vars.
+// Will populate Env struct with env vars. Fields tagged with `default:"..."`
+// are optional and fall back to the tag value when unset.
 func loadEnv(app *application) {
 	enverr := godotenv.Load()
 	if enverr != nil {
@@ -55,7 +69,19 @@ func loadEnv(app *application) {
 		os.Exit(1)
 	}
 
-	app.env = &Env{}
+	env, err := readEnv(os.Getenv)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("Error loading .env file. %s", err))
+		os.Exit(1)
+	}
+
+	app.env = env
+}
+
+// Build an Env from the values returned by lookup, falling back to each
+// field's default when the value is empty.
+func readEnv(lookup func(string) string) (*Env, error) {
+	env := &Env{}
 
 	fields := reflect.VisibleFields(reflect.TypeOf(struct{ Env }{}))
 
@@ -64,13 +90,18 @@ func loadEnv(app *application) {
 			continue
 		}
 		up := strings.ToUpper(field.Name)
-		v := os.Getenv(up)
+		v := lookup(up)
 		if v == "" {
-			app.logger.Error(fmt.Sprintf("Error loading .env file. Missing: %s", up))
-			os.Exit(1)
+			def, ok := field.Tag.Lookup("default")
+			if !ok {
+				return nil, fmt.Errorf("Missing: %s", up)
+			}
+			v = def
 		}
-		reflect.ValueOf(app.env).Elem().FieldByName(field.Name).SetString(v)
+		reflect.ValueOf(env).Elem().FieldByName(field.Name).SetString(v)
 	}
+
+	return env, nil
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data templateData) {
@@ -78,15 +109,14 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	// name (like 'home.tmpl'). If no entry exists in the cache with the
 	// provided name, then create a new error and call the serverError() helper
 	// method that we made earlier and return.
-	ts, ok := app.templateCache[page]
-	if !ok {
-		err := fmt.Errorf("the template %s does not exist", page)
+	ts, err := app.template(page)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
 	buf := new(bytes.Buffer)
-	err := ts.ExecuteTemplate(buf, "base", data)
+	err = ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -98,24 +128,165 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	buf.WriteTo(w)
 }
 
+// The writeJSON helper encodes data as JSON and sends it with the given status
+// code and any extra headers.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	// Given headers can override the content type.
+	w.Header().Set("Content-Type", "application/json")
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// Parse a comma-separated list of expiry days (e.g. "1,7,365") into a
+// sorted list without duplicates. Every entry must be a positive whole
+// number and there must be at least one.
+func parseExpiryDays(list string) ([]int, error) {
+	var days []int
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(entry)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid EXPIRY_DAYS entry %q", entry)
+		}
+		days = append(days, n)
+	}
+
+	if len(days) == 0 {
+		return nil, errors.New("EXPIRY_DAYS must list at least one number of days")
+	}
+
+	slices.Sort(days)
+
+	return slices.Compact(days), nil
+}
+
+// List the permitted expiries for error messages, e.g. "1, 7 or 365".
+func expiryChoices() string {
+	choices := make([]string, len(models.PermittedExpiries))
+	for i, days := range models.PermittedExpiries {
+		choices[i] = strconv.Itoa(days)
+	}
+
+	if len(choices) == 1 {
+		return choices[0]
+	}
+
+	return strings.Join(choices[:len(choices)-1], ", ") + " or " + choices[len(choices)-1]
+}
+
+// Return the URL of the current page, base path included, with the query
+// parameter key set to value. It's used for pagination links.
+func (app *application) pageURL(r *http.Request, key, value string) string {
+	q := r.URL.Query()
+	q.Set(key, value)
+	return app.basePath + r.URL.Path + "?" + q.Encode()
+}
+
+// Describe a listing's pagination in headers, so clients needn't parse the
+// body: X-Total-Count, X-Page (when page isn't 0) and a Link header (RFC
+// 5988) with the next and previous pages' URLs, where there are any.
+func setPaginationHeaders(w http.ResponseWriter, total, page int, next, prev string) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if page != 0 {
+		w.Header().Set("X-Page", strconv.Itoa(page))
+	}
+
+	var links []string
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, prev))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// Parse a ?limit= style value. Anything that isn't a positive integer falls
+// back to def rather than being an error, and values above maxLimit are
+// capped.
+func parseLimit(value string, def, maxLimit int) int {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return def
+	}
+
+	if limit > maxLimit {
+		return maxLimit
+	}
+
+	return limit
+}
+
 // Common data function.
 func (app *application) newTemplateData(r *http.Request) templateData {
 	return templateData{
-		CurrentYear: time.Now().Year(),
-		Flash:       app.sessionManager.PopString(r.Context(), "flash"),
+		CurrentYear:       time.Now().Year(),
+		Flash:             app.sessionManager.PopString(r.Context(), "flash"),
+		CSRFToken:         nosurf.Token(r),
+		IsAuthenticated:   app.isAuthenticated(r),
+		IsAdmin:           app.isAdmin(r),
+		ExpiresSoonWithin: app.expiresSoonWithin,
+		UndoDeleteID:      app.undoDeleteID(r),
+		Locale:            requestLocale(r),
+		SiteNotice:        app.currentSiteNotice(r),
+		CanShare:          app.shareSecret != nil,
+		BasePath:          app.basePath,
+		Expiries:          models.PermittedExpiries,
 	}
 }
 
+// Memory used for multipart form parsing before files are written to disk.
+const maxUploadMemory = 1 << 20
+
 // Create a new decodePostForm() helper method. The second parameter here, dst,
 // is the target destination that we want to decode the form data into.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
-	// Call ParseForm() on the request, in the same way that we did in our
-	// createSnippetPost handler.
-	err := r.ParseForm()
+	// Forms with a file input are sent as multipart/form-data. Those are
+	// parsed with ParseMultipartForm(), which also fills r.PostForm, keeping
+	// up to maxUploadMemory in memory and spilling the rest to disk.
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(maxUploadMemory)
+	} else {
+		// Call ParseForm() on the request, in the same way that we did in our
+		// createSnippetPost handler.
+		err = r.ParseForm()
+	}
 	if err != nil {
 		return err
 	}
 
+	// Fields taking several values may be sent with a "[]" suffix on the name
+	// (e.g. "tags[]"), which the decoder doesn't understand. Fold them into
+	// the plain name, which decodes into a slice.
+	for key, values := range r.PostForm {
+		if name, ok := strings.CutSuffix(key, "[]"); ok {
+			r.PostForm[name] = append(r.PostForm[name], values...)
+			delete(r.PostForm, key)
+		}
+	}
+
 	// Call Decode() on our decoder instance, passing the target destination as
 	// the first parameter.
 	err = app.formDecoder.Decode(dst, r.PostForm)
@@ -136,3 +307,164 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 
 	return nil
 }
+
+// Return true if the current request is from an authenticated user, as
+// determined by the authenticate middleware.
+func (app *application) isAuthenticated(r *http.Request) bool {
+	return contextIsAuthenticated(r)
+}
+
+// Return true if the current request is from an authenticated admin user.
+func (app *application) isAdmin(r *http.Request) bool {
+	return contextIsAdmin(r)
+}
+
+// Return the id of the snippet the user can still undo the deletion of, or 0
+// if there isn't one or the undo window has passed.
+func (app *application) undoDeleteID(r *http.Request) int {
+	until := time.UnixMilli(app.sessionManager.GetInt64(r.Context(), "undoDeleteUntil"))
+	if time.Now().After(until) {
+		return 0
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "undoDeleteID")
+}
+
+// Report whether the server is configured to serve TLS itself.
+func (app *application) tlsEnabled() bool {
+	return app.env.TLS_CERT_FILE != "" && app.env.TLS_KEY_FILE != ""
+}
+
+// Apply the SESSION_COOKIE_* settings to the session manager's cookie.
+func (app *application) configureSessionCookie() error {
+	cookie := &app.sessionManager.Cookie
+
+	cookie.Name = app.env.SESSION_COOKIE_NAME
+	cookie.Path = app.env.SESSION_COOKIE_PATH
+
+	switch strings.ToLower(app.env.SESSION_COOKIE_SAMESITE) {
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("invalid SESSION_COOKIE_SAMESITE %q", app.env.SESSION_COOKIE_SAMESITE)
+	}
+
+	cookie.Secure = app.tlsEnabled()
+	if app.env.SESSION_COOKIE_SECURE != "" {
+		secure, err := strconv.ParseBool(app.env.SESSION_COOKIE_SECURE)
+		if err != nil {
+			return fmt.Errorf("invalid SESSION_COOKIE_SECURE %q", app.env.SESSION_COOKIE_SECURE)
+		}
+		cookie.Secure = secure
+	}
+
+	return nil
+}
+
+// Return the id of the logged in user, or 0 for anonymous requests. It's
+// read from the request context rather than the session, so that it works
+// for API requests authenticated by token too.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	return contextUserID(r)
+}
+
+// Return true if the current user owns the snippet or is an admin. Snippets
+// created anonymously have no owner, so only admins can manage them.
+func (app *application) canManage(r *http.Request, snippet models.Snippet) bool {
+	if app.isAdmin(r) {
+		return true
+	}
+
+	userID := app.authenticatedUserID(r)
+	return userID != 0 && snippet.UserID == userID
+}
+
+// Return the snippet model limited to the workspace of the current request.
+// Handlers should always go through this rather than app.snippets, so that
+// snippets in other workspaces are treated as missing. Its queries run under
+// the request's context, so they stop when the request is cancelled or times
+// out.
+func (app *application) workspaceSnippets(r *http.Request) models.SnippetModelInterface {
+	return app.snippets.ForWorkspace(contextWorkspaceID(r)).WithContext(r.Context())
+}
+
+// Record a change to a snippet in the audit log. A failure to write the entry
+// is logged but doesn't fail the change itself, which has already been made.
+func (app *application) auditLog(r *http.Request, action string, snippetID int, detail string) {
+	err := app.audit.LogAction(models.AuditEntry{
+		WorkspaceID: contextWorkspaceID(r),
+		UserID:      app.authenticatedUserID(r),
+		SnippetID:   snippetID,
+		Action:      action,
+		Detail:      detail,
+		IP:          app.realIP(r),
+	})
+	if err != nil {
+		app.requestLogger(r).Error("audit log", "error", err.Error(), "action", action, "snippet_id", snippetID)
+	}
+}
+
+// Check the current user's snippet quota before creating another snippet.
+// It returns models.ErrQuotaExceeded when they're at or over it. Anonymous
+// snippets and admins aren't limited, and nor is anyone when the quota is 0.
+func (app *application) checkSnippetQuota(r *http.Request) error {
+	userID := app.authenticatedUserID(r)
+	if app.snippetQuota == 0 || userID == 0 || app.isAdmin(r) {
+		return nil
+	}
+
+	count, err := app.workspaceSnippets(r).CountByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if count >= app.snippetQuota {
+		return models.ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// Return the site notice to show on this request: the configured notice,
+// unless this session has dismissed it. Dismissals are remembered by the
+// notice text, so a new notice shows up again.
+func (app *application) currentSiteNotice(r *http.Request) string {
+	notice, _ := app.siteNotice.Load().(string)
+	if notice == "" || app.sessionManager.GetString(r.Context(), "dismissedNotice") == notice {
+		return ""
+	}
+	return notice
+}
+
+// Report whether r is a liveness or readiness probe.
+func isHealthCheck(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/readyz"
+}
+
+// Report whether r is for the JSON API, which answers errors in JSON rather
+// than HTML.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// Return the scheme, host and base path the site is being reached on, e.g.
+// "https://snippetbox.example.com", for building absolute links. The
+// canonical host wins when one is configured.
+func (app *application) siteURL(r *http.Request) string {
+	if app.env.CANONICAL_HOST != "" {
+		return "https://" + app.env.CANONICAL_HOST + app.basePath
+	}
+
+	if r.TLS != nil {
+		return "https://" + r.Host + app.basePath
+	}
+	return "http://" + r.Host + app.basePath
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodePostFormTags(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+		want []string
+	}{
+		{
+			name: "Repeated",
+			form: url.Values{"tags": {"go", "sql", "web"}},
+			want: []string{"go", "sql", "web"},
+		},
+		{
+			name: "Bracketed",
+			form: url.Values{"tags[]": {"go", "sql"}},
+			want: []string{"go", "sql"},
+		},
+		{
+			name: "Single",
+			form: url.Values{"tags": {"go"}},
+			want: []string{"go"},
+		},
+		{
+			name: "None",
+			form: url.Values{"title": {"A title"}},
+			want: nil,
+		},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/snippet/create", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			var form snippetCreateForm
+			err := app.decodePostForm(r, &form)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(form.Tags, tt.want) {
+				t.Errorf("got tags %q; want %q", form.Tags, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigureSessionCookie(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          Env
+		wantSameSite http.SameSite
+		wantSecure   bool
+		wantErr      bool
+	}{
+		{
+			name:         "Defaults without TLS",
+			env:          Env{SESSION_COOKIE_NAME: "session", SESSION_COOKIE_PATH: "/", SESSION_COOKIE_SAMESITE: "lax"},
+			wantSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:         "Defaults with TLS",
+			env:          Env{SESSION_COOKIE_NAME: "session", SESSION_COOKIE_PATH: "/", SESSION_COOKIE_SAMESITE: "lax", TLS_CERT_FILE: "cert.pem", TLS_KEY_FILE: "key.pem"},
+			wantSameSite: http.SameSiteLaxMode,
+			wantSecure:   true,
+		},
+		{
+			name:         "Configured",
+			env:          Env{SESSION_COOKIE_NAME: "sb_session", SESSION_COOKIE_PATH: "/app", SESSION_COOKIE_SAMESITE: "Strict", SESSION_COOKIE_SECURE: "true"},
+			wantSameSite: http.SameSiteStrictMode,
+			wantSecure:   true,
+		},
+		{
+			name:         "Secure turned off with TLS",
+			env:          Env{SESSION_COOKIE_NAME: "session", SESSION_COOKIE_PATH: "/", SESSION_COOKIE_SAMESITE: "none", SESSION_COOKIE_SECURE: "false", TLS_CERT_FILE: "cert.pem", TLS_KEY_FILE: "key.pem"},
+			wantSameSite: http.SameSiteNoneMode,
+		},
+		{
+			name:    "Invalid SameSite",
+			env:     Env{SESSION_COOKIE_SAMESITE: "sometimes"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Secure",
+			env:     Env{SESSION_COOKIE_SAMESITE: "lax", SESSION_COOKIE_SECURE: "maybe"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.env = &tt.env
+
+			err := app.configureSessionCookie()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The attributes appear on the cookie the session manager sets.
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.sessionManager.Put(r.Context(), "flash", "Hello")
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			app.sessionManager.LoadAndSave(next).ServeHTTP(rr, r)
+
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies; want 1", len(cookies))
+			}
+
+			c := cookies[0]
+			if c.Name != tt.env.SESSION_COOKIE_NAME || c.Path != tt.env.SESSION_COOKIE_PATH {
+				t.Errorf("got name %q path %q; want %q and %q", c.Name, c.Path, tt.env.SESSION_COOKIE_NAME, tt.env.SESSION_COOKIE_PATH)
+			}
+			if c.SameSite != tt.wantSameSite {
+				t.Errorf("got SameSite %v; want %v", c.SameSite, tt.wantSameSite)
+			}
+			if c.Secure != tt.wantSecure {
+				t.Errorf("got Secure %t; want %t", c.Secure, tt.wantSecure)
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{name: "Default", value: "", want: 20},
+		{name: "Valid", value: "5", want: 5},
+		{name: "At cap", value: "100", want: 100},
+		{name: "Over cap", value: "500", want: 100},
+		{name: "Zero", value: "0", want: 20},
+		{name: "Negative", value: "-3", want: 20},
+		{name: "Not a number", value: "ten", want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLimit(tt.value, 20, 100); got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMissingPage(t *testing.T) {
+	var logs bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	app.render(w, r, http.StatusOK, "missing.tmpl", templateData{})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d; want %d", w.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(logs.String(), "missing.tmpl") {
+		t.Errorf("want the logged error to name the page; got %q", logs.String())
+	}
+}
+
+func TestRenderExecutionError(t *testing.T) {
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// The template writes some markup before failing on a missing field, so
+	// a direct write to the response would leave partial HTML behind.
+	app.templateCache = map[string]*template.Template{
+		"broken.tmpl": template.Must(template.New("base").Parse(`<html><body>{{.Missing.Field}}</body></html>`)),
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	app.render(w, r, http.StatusOK, "broken.tmpl", templateData{})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d; want %d", w.Code, http.StatusInternalServerError)
+	}
+	if body := w.Body.String(); strings.Contains(body, "<html>") {
+		t.Errorf("want no partial HTML in the body; got %q", body)
+	}
+}
+
+func TestParseExpiryDays(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{name: "Default", list: "1,7,365", want: []int{1, 7, 365}},
+		{name: "Spaces and order", list: " 30, 3 ", want: []int{3, 30}},
+		{name: "Duplicates", list: "7,7,1", want: []int{1, 7}},
+		{name: "Empty entries skipped", list: "3,,30,", want: []int{3, 30}},
+		{name: "Empty", list: "", wantErr: true},
+		{name: "Zero", list: "0,7", wantErr: true},
+		{name: "Negative", list: "-1", wantErr: true},
+		{name: "Not a number", list: "7,week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpiryDays(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Parse a comma-separated list of CIDR ranges (e.g. "10.0.0.0/8,127.0.0.1").
+// Bare addresses are treated as single-host ranges.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// Report whether addr falls inside one of the trusted proxy ranges.
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether the request's direct peer is a trusted proxy, whose
+// forwarding headers can be believed.
+func (app *application) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	return err == nil && app.isTrustedProxy(peer)
+}
+
+// Return the scheme ("http" or "https") the client used for the request.
+// Behind a trusted proxy it's taken from X-Forwarded-Proto, since the proxy
+// may terminate TLS; otherwise it's whether the connection itself is TLS.
+func (app *application) requestScheme(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-Proto"); fwd != "" && app.fromTrustedProxy(r) {
+		// Proxies may append to the header, the first entry is the client's.
+		return strings.ToLower(strings.TrimSpace(strings.Split(fwd, ",")[0]))
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// The realIP helper returns the client IP for a request. Forwarding headers
+// are only honoured when the direct peer is a trusted proxy, otherwise anyone
+// could spoof them. X-Forwarded-For is walked from the right, skipping our own
+// proxies, and the first untrusted address is taken as the client. Malformed
+// headers are ignored in favour of the peer address.
+func (app *application) realIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !app.fromTrustedProxy(r) {
+		return host
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return host
+			}
+			if !app.isTrustedProxy(addr) {
+				return addr.Unmap().String()
+			}
+		}
+	}
+
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		addr, err := netip.ParseAddr(strings.TrimSpace(xri))
+		if err == nil {
+			return addr.Unmap().String()
+		}
+	}
+
+	return host
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{
+			name:       "Untrusted peer",
+			remoteAddr: "203.0.113.7:4000",
+			xff:        "198.51.100.1",
+			xRealIP:    "198.51.100.2",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Trusted peer",
+			remoteAddr: "10.0.0.1:4000",
+			xff:        "198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Trusted peer, chained proxies",
+			remoteAddr: "10.0.0.1:4000",
+			xff:        "198.51.100.1, 10.0.0.2",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed leftmost entry",
+			remoteAddr: "10.0.0.1:4000",
+			xff:        "1.2.3.4, 198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Malformed entry",
+			remoteAddr: "10.0.0.1:4000",
+			xff:        "198.51.100.1, not-an-ip",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "Trusted peer, X-Real-IP",
+			remoteAddr: "10.0.0.1:4000",
+			xRealIP:    "198.51.100.2",
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "Trusted peer, no headers",
+			remoteAddr: "10.0.0.1:4000",
+			want:       "10.0.0.1",
+		},
+	}
+
+	app := newTestApplication(t)
+
+	var err error
+	app.trustedProxies, err = parseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xRealIP != "" {
+				r.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+
+			if got := app.realIP(r); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
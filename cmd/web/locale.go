@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// The locales dates can be displayed in. The first entry is the default used
+// when nothing in Accept-Language matches.
+var supportedLocales = []language.Tag{
+	language.English,
+	language.French,
+	language.German,
+	language.Spanish,
+}
+
+var localeMatcher = language.NewMatcher(supportedLocales)
+
+// Abbreviated month names per locale, January first.
+var monthNames = map[string][12]string{
+	"en": {"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	"fr": {"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	"de": {"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+	"es": {"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+}
+
+// Date layouts per locale, filled with day, month name, year and time.
+var dateLayouts = map[string]string{
+	"en": "%02d %s %d at %s",
+	"fr": "%02d %s %d à %s",
+	"de": "%02d. %s %d um %s",
+	"es": "%02d %s %d a las %s",
+}
+
+// Pick the best supported locale for the request from its Accept-Language
+// header, returned as a base language code like "en".
+func requestLocale(r *http.Request) string {
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+
+	_, index, _ := localeMatcher.Match(tags...)
+	base, _ := supportedLocales[index].Base()
+
+	return base.String()
+}
+
+// Format t for display in the given locale, falling back to English for a
+// locale we don't have names for.
+func formatDate(t time.Time, locale string) string {
+	layout, ok := dateLayouts[locale]
+	if !ok {
+		locale, layout = "en", dateLayouts["en"]
+	}
+
+	return fmt.Sprintf(layout, t.Day(), monthNames[locale][t.Month()-1], t.Year(), t.Format("15:04"))
+}
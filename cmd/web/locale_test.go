@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "None", acceptLanguage: "", want: "en"},
+		{name: "French", acceptLanguage: "fr-FR,fr;q=0.9", want: "fr"},
+		{name: "Weighted", acceptLanguage: "ja;q=0.9,de;q=0.8", want: "de"},
+		{name: "Unsupported", acceptLanguage: "ja", want: "en"},
+		{name: "Malformed", acceptLanguage: "!!", want: "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			if got := requestLocale(r); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "en", want: "17 Mar 2024 at 10:15"},
+		{locale: "fr", want: "17 mars 2024 à 10:15"},
+		{locale: "de", want: "17. März 2024 um 10:15"},
+		{locale: "es", want: "17 mar 2024 a las 10:15"},
+		{locale: "xx", want: "17 Mar 2024 at 10:15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			if got := formatDate(date, tt.locale); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// A loginLockout tracks failed login attempts per key (email and client IP)
+// in memory. Once a key reaches maxAttempts failures within window, further
+// attempts are refused until the window since the first failure has passed.
+type loginLockout struct {
+	mu          sync.Mutex
+	maxAttempts int
+	window      time.Duration
+	failures    map[string]loginFailures
+}
+
+type loginFailures struct {
+	count int
+	first time.Time
+}
+
+func newLoginLockout(maxAttempts int, window time.Duration) *loginLockout {
+	return &loginLockout{
+		maxAttempts: maxAttempts,
+		window:      window,
+		failures:    make(map[string]loginFailures),
+	}
+}
+
+// Locked reports whether key is currently locked out and, if so, how long
+// until it may try again.
+func (l *loginLockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[key]
+	if !ok {
+		return false, 0
+	}
+
+	remaining := l.window - time.Since(f.first)
+	if remaining <= 0 {
+		delete(l.failures, key)
+		return false, 0
+	}
+
+	return f.count >= l.maxAttempts, remaining
+}
+
+// Fail records a failed attempt for key.
+func (l *loginLockout) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	f, ok := l.failures[key]
+	if !ok || now.Sub(f.first) >= l.window {
+		f = loginFailures{first: now}
+	}
+	f.count++
+	l.failures[key] = f
+
+	// Drop expired entries now and then so the map can't grow unbounded.
+	if len(l.failures) > 1000 {
+		for k, f := range l.failures {
+			if now.Sub(f.first) >= l.window {
+				delete(l.failures, k)
+			}
+		}
+	}
+}
+
+// Reset clears the failures for key, e.g. after a successful login.
+func (l *loginLockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	const key = "alice@example.com"
+
+	t.Run("Threshold", func(t *testing.T) {
+		l := newLoginLockout(3, time.Minute)
+
+		for i := 1; i < 3; i++ {
+			l.Fail(key)
+			if locked, _ := l.Locked(key); locked {
+				t.Fatalf("locked after %d failures; want 3", i)
+			}
+		}
+
+		l.Fail(key)
+		locked, remaining := l.Locked(key)
+		if !locked {
+			t.Fatal("not locked after 3 failures")
+		}
+		if remaining <= 0 || remaining > time.Minute {
+			t.Errorf("got %v remaining; want between 0 and 1m", remaining)
+		}
+
+		// Other keys aren't affected.
+		if locked, _ := l.Locked("bob@example.com"); locked {
+			t.Error("another key is locked")
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		l := newLoginLockout(3, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			l.Fail(key)
+		}
+		l.Reset(key)
+
+		if locked, _ := l.Locked(key); locked {
+			t.Error("locked after reset")
+		}
+	})
+
+	t.Run("Window passed", func(t *testing.T) {
+		l := newLoginLockout(1, 10*time.Millisecond)
+
+		l.Fail(key)
+		if locked, _ := l.Locked(key); !locked {
+			t.Fatal("not locked after 1 failure")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		if locked, _ := l.Locked(key); locked {
+			t.Error("still locked after the window passed")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Parse a log level name: debug, info, warn or error.
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q", level)
+	}
+}
+
+// Build the application logger. The format selects the slog handler ("text"
+// or "json"), the level sets the minimum level emitted (and can be changed
+// later, e.g. on a config reload) and addSource toggles the source file/line
+// attribute.
+func newLogger(w io.Writer, format string, level *slog.LevelVar, addSource bool) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{
+		AddSource: addSource,
+		Level:     level,
+	}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// Return a copy of the request whose context carries a child of the request
+// logger with the given attributes added (e.g. "route", "snippet_id"). Every
+// later call to app.requestLogger() for the request includes them.
+func (app *application) withLogAttrs(r *http.Request, args ...any) *http.Request {
+	return contextSetLogger(r, app.requestLogger(r).With(args...))
+}
+
+// Return the logger for a request: the one stored by withLogAttrs() if there
+// is one, otherwise the application logger.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	return app.contextLogger(r.Context())
+}
+
+// Like requestLogger, for code which only has the request's context.
+func (app *application) contextLogger(ctx context.Context) *slog.Logger {
+	if logger := loggerFromContext(ctx); logger != nil {
+		return logger
+	}
+	return app.logger
+}
+
+// Log a model query and its duration: every query at debug level when
+// logAllQueries is set, and any query slower than slowQueryThreshold (if
+// set) as a warning. Queries run for a request are logged with its logger,
+// so they carry its request id. Statements are spread over several lines in
+// the models, so collapse the whitespace first.
+func (app *application) logQuery(ctx context.Context, stmt string, elapsed time.Duration) {
+	logger := app.contextLogger(ctx)
+
+	if app.logAllQueries {
+		logger.Debug("query", "stmt", strings.Join(strings.Fields(stmt), " "), "elapsed", elapsed)
+	}
+
+	if app.slowQueryThreshold > 0 && elapsed > app.slowQueryThreshold {
+		logger.Warn("slow query", "stmt", strings.Join(strings.Fields(stmt), " "), "elapsed", elapsed, "threshold", app.slowQueryThreshold)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{"Text", "text", false},
+		{"JSON", "json", false},
+		{"Mixed case", "JSON", false},
+		{"Unknown", "xml", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := newLogger(io.Discard, tt.format, new(slog.LevelVar), false)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch handler := logger.Handler().(type) {
+			case *slog.TextHandler:
+				if tt.format != "text" {
+					t.Errorf("got %T for format %q", handler, tt.format)
+				}
+			case *slog.JSONHandler:
+				if tt.format == "text" {
+					t.Errorf("got %T for format %q", handler, tt.format)
+				}
+			default:
+				t.Errorf("got unexpected handler %T", handler)
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		level   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"info", slog.LevelInfo, false},
+		{"WARN", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			got, err := parseLogLevel(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got level %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithLogAttrs(t *testing.T) {
+	var buf bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/snippet/view/1", nil)
+
+	// Without attributes the application logger is used as is.
+	if app.requestLogger(r) != app.logger {
+		t.Error("want the application logger for a plain request")
+	}
+
+	r = app.withLogAttrs(r, "route", "snippetView", "snippet_id", 1)
+	r = app.withLogAttrs(r, "user_id", 5)
+	app.requestLogger(r).Info("viewed")
+
+	var line map[string]any
+	err := json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"msg": "viewed", "route": "snippetView", "snippet_id": 1.0, "user_id": 5.0}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("got %s %v; want %v", key, line[key], value)
+		}
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		logAllQueries bool
+		slowThreshold time.Duration
+		elapsed       time.Duration
+		wantMsg       string
+		wantLevel     string
+	}{
+		{name: "Dev", logAllQueries: true, elapsed: time.Millisecond, wantMsg: "query", wantLevel: "DEBUG"},
+		{name: "Prod", logAllQueries: false, elapsed: time.Millisecond},
+		{name: "Prod slow query", logAllQueries: false, slowThreshold: 100 * time.Millisecond, elapsed: time.Second, wantMsg: "slow query", wantLevel: "WARN"},
+		{name: "Prod fast query", logAllQueries: false, slowThreshold: 100 * time.Millisecond, elapsed: 99 * time.Millisecond},
+		{name: "Prod query at the threshold", logAllQueries: false, slowThreshold: 100 * time.Millisecond, elapsed: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			app := newTestApplication(t)
+			app.logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			app.logAllQueries = tt.logAllQueries
+			app.slowQueryThreshold = tt.slowThreshold
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = app.withLogAttrs(r, "request_id", "abc123")
+
+			app.logQuery(r.Context(), "SELECT id\n\tFROM snippets", tt.elapsed)
+
+			if tt.wantMsg == "" {
+				if buf.Len() != 0 {
+					t.Errorf("got log output %q; want none", buf.String())
+				}
+				return
+			}
+
+			var line map[string]any
+			err := json.Unmarshal(buf.Bytes(), &line)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]any{"msg": tt.wantMsg, "level": tt.wantLevel, "stmt": "SELECT id FROM snippets", "request_id": "abc123"}
+			for key, value := range want {
+				if line[key] != value {
+					t.Errorf("got %s %v; want %v", key, line[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	var logged string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.requestLogger(r).Info("handled")
+		logged = buf.String()
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	app.requestID(next).ServeHTTP(w, r)
+
+	id := w.Header().Get("X-Request-Id")
+	if len(id) != 16 {
+		t.Fatalf("got X-Request-Id %q; want 16 hex characters", id)
+	}
+	if !strings.Contains(logged, `"request_id":"`+id+`"`) {
+		t.Errorf("want the request id in %q", logged)
+	}
+}
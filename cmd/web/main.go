@@ -2,54 +2,419 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"io"
 	"log/slog"
-	"net/http"
+	"net/netip"
 	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/joshuagageellis/snippetbox.git/internal/validator"
 )
 
 type Env struct {
-	PORT string
-	HOST string
-	DSN  string
-	ENV  string
+	PORT       string
+	HOST       string
+	DSN        string
+	ENV        string
+	LOG_FORMAT string `default:"text"`
+	LOG_LEVEL  string `default:"info"`
+	LOG_SOURCE string `default:"true"`
+	// How requests are logged: "slog" (structured, in LOG_FORMAT),
+	// "combined" (Apache Combined Log Format lines) or "both".
+	LOG_ACCESS_FORMAT string `default:"slog"`
+	// Log queries taking longer than this many milliseconds as warnings. 0
+	// disables it.
+	SLOW_QUERY_MS string `default:"0"`
+	// Number of times to try reaching the database on startup.
+	DB_CONNECT_ATTEMPTS string `default:"5"`
+	// TLS for the database connections: true, skip-verify, or the path of a
+	// CA certificate file. Empty or false for none.
+	DB_TLS string `default:""`
+	// Path prefix the site is served under behind a proxy, e.g. "/snippets".
+	// Leave empty to serve from the root.
+	BASE_PATH string `default:""`
+	// Host to redirect to over https, e.g. "snippetbox.example.com". Leave
+	// empty to disable the redirect. Behind a proxy which terminates TLS, the
+	// proxy must be in TRUSTED_PROXIES.
+	CANONICAL_HOST string `default:""`
+	// Comma-separated CIDR ranges of proxies allowed to set X-Forwarded-For
+	// and X-Forwarded-Proto.
+	TRUSTED_PROXIES string `default:""`
+	// Comma-separated origins, besides the site itself, allowed to submit
+	// forms, e.g. "https://admin.example.com".
+	TRUSTED_ORIGINS string `default:""`
+	// Key used to sign share links, at least 32 characters. Leave empty to
+	// disable sharing.
+	SHARE_SECRET string `default:""`
+	// How long a share link stays valid.
+	SHARE_LINK_TTL string `default:"24h"`
+	// Maximum time a request may take before a 503 is returned. Set to 0 to
+	// disable.
+	REQUEST_TIMEOUT string `default:"30s"`
+	// Snippets expiring within this duration get an "expires soon" badge.
+	EXPIRES_SOON string `default:"24h"`
+	// DSN of a read replica. Leave empty to read from the primary.
+	READ_DSN string `default:""`
+	// How often to check the database is still reachable, for /readyz.
+	DB_MONITOR_INTERVAL string `default:"15s"`
+	// Announcement shown at the top of every page. Leave empty for none.
+	SITE_NOTICE string `default:""`
+	// Start with the site in maintenance mode.
+	MAINTENANCE_MODE string `default:"false"`
+	// Serve over TLS when both of these are set.
+	TLS_CERT_FILE string `default:""`
+	TLS_KEY_FILE  string `default:""`
+	// HTTP/2 support: "off", "on" (h2 over TLS) or "h2c" (cleartext, for
+	// running behind a proxy which speaks HTTP/2 to the app).
+	HTTP2 string `default:"off"`
+	// Session cookie attributes. SESSION_COOKIE_SECURE defaults to on when
+	// TLS is enabled and off otherwise.
+	SESSION_COOKIE_NAME     string `default:"session"`
+	SESSION_COOKIE_PATH     string `default:"/"`
+	SESSION_COOKIE_SAMESITE string `default:"lax"`
+	SESSION_COOKIE_SECURE   string `default:""`
+	// Upper bound for the ?limit= parameter on listings.
+	MAX_LIST_LIMIT string `default:"100"`
+	// Longest query string (414 above it) and longest single query parameter
+	// value (400 above it) accepted by listing routes, in bytes.
+	MAX_QUERY_LENGTH       string `default:"2048"`
+	MAX_QUERY_PARAM_LENGTH string `default:"256"`
+	// Largest snippet content accepted, in bytes. A TEXT column holds at most
+	// 65535 bytes, so larger limits need SNIPPET_CONTENT_MEDIUMTEXT as well.
+	MAX_CONTENT_BYTES          string `default:"65535"`
+	SNIPPET_CONTENT_MEDIUMTEXT string `default:"false"`
+	// Comma-separated numbers of days a snippet may be kept for.
+	EXPIRY_DAYS string `default:"1,7,365"`
+	// Expiry (in days) selected by default on the create form, and used when
+	// an API request leaves it out. Must be one of the permitted values.
+	DEFAULT_EXPIRY_DAYS string `default:"365"`
+	// Most live snippets a (non-admin) user may have. 0 means no limit.
+	SNIPPET_QUOTA string `default:"100"`
+	// Number of snippets to keep in an in-memory cache for views, and how
+	// long each stays cached. A size of 0 disables the cache.
+	SNIPPET_CACHE_SIZE string `default:"0"`
+	SNIPPET_CACHE_TTL  string `default:"1m"`
+	// Keep the first page of the home page listing in memory for this long,
+	// e.g. "5s". 0 disables it.
+	LATEST_CACHE_TTL string `default:"0"`
+	// Prepare the statements of the hottest snippet queries once at startup.
+	SNIPPET_PREPARED_STATEMENTS string `default:"false"`
+	// Icon served at /favicon.ico.
+	FAVICON_FILE string `default:"./ui/static/img/favicon.ico"`
+	// Log requests for the favicon, manifest and static files.
+	LOG_ASSET_REQUESTS string `default:"true"`
+	// IANA time zone dates are displayed in, e.g. "Europe/London".
+	DISPLAY_TZ string `default:"UTC"`
+	// How untrusted HTML output by templates is cleaned: strict|ugc|relaxed.
+	SANITIZE_POLICY string `default:"ugc"`
+	// Serve the pprof endpoints under /debug/pprof/ (to admins only).
+	PPROF_ENABLED string `default:"false"`
+	// Re-parse templates from disk on every request (for development).
+	TEMPLATE_RELOAD string `default:"false"`
+	// Failed logins allowed per email and IP within the lockout window.
+	LOGIN_MAX_ATTEMPTS   string `default:"5"`
+	LOGIN_LOCKOUT_WINDOW string `default:"15m"`
+	// Requests allowed per client IP per window. 0 disables rate limiting.
+	// The store is "memory" (per instance) or "mysql" (shared).
+	RATE_LIMIT_REQUESTS string `default:"0"`
+	RATE_LIMIT_WINDOW   string `default:"1m"`
+	RATE_LIMIT_STORE    string `default:"memory"`
 }
 
 // Application dependencies.
 type application struct {
 	logger         *slog.Logger
-	snippets       *models.SnippetModel
+	logLevel       *slog.LevelVar
+	started        time.Time
+	db             *sql.DB
+	snippets       models.SnippetModelInterface
+	users          models.UserModelInterface
+	audit          models.AuditModelInterface
+	reports        models.ReportModelInterface
+	reportLimiter  *rateLimiter
+	dbMonitor      *dbMonitor
+	shutdown       chan struct{}
+	broadcaster    *broadcaster
 	env            *Env
 	templateCache  map[string]*template.Template
+	templateReload bool
+	pprofEnabled   bool
+	logAssets      bool
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	trustedProxies []netip.Prefix
+	trustedOrigins []string
+	basePath       string
+	requestTimeout time.Duration
+	shareSecret    []byte
+	shareLinkTTL   time.Duration
+
+	// Which access log lines logRequest writes, and where the combined
+	// format ones go.
+	logAccessFormat string
+	accessLog       io.Writer
+
+	logAllQueries      bool
+	slowQueryThreshold time.Duration
+
+	expiresSoonWithin time.Duration
+	maintenance       atomic.Bool
+	siteNotice        atomic.Value
+	maxListLimit      int
+	maxQueryLength    int
+	maxQueryParam     int
+	maxContentBytes   int
+	defaultExpiry     int
+	snippetQuota      int
+	loginLockout      *loginLockout
+	rateLimiter       *rateLimiter
 }
 
 func main() {
-	// Logger.
+	// Subcommands are given as the first argument, e.g. "web create-admin
+	// -email ...". Their own flags are parsed by the subcommand.
+	var (
+		subcommand     string
+		subcommandArgs []string
+	)
+	if len(os.Args) > 1 && (os.Args[1] == "create-admin" || os.Args[1] == "backfill") {
+		subcommand, subcommandArgs = os.Args[1], os.Args[2:]
+	}
+
+	// Command line flags.
+	checkDB := flag.Bool("check-db", false, "Verify the database connection and exit without starting the server")
+	if subcommand == "" {
+		flag.Parse()
+	}
+
+	// Bootstrap logger, used until the configured one is built from env.
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource: true,
 	}))
 
 	// Init new application.
+	// The start time is taken first thing, for the uptime in /status.
 	app := &application{
-		logger: logger,
+		logger:  logger,
+		started: time.Now(),
 	}
 
 	// Load env.
 	loadEnv(app)
 
+	// Logger.
+	addSource, err := strconv.ParseBool(app.env.LOG_SOURCE)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid LOG_SOURCE %q", app.env.LOG_SOURCE))
+		os.Exit(1)
+	}
+
+	level, err := parseLogLevel(app.env.LOG_LEVEL)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	app.logLevel = new(slog.LevelVar)
+	app.logLevel.Set(level)
+
+	app.logger, err = newLogger(os.Stdout, app.env.LOG_FORMAT, app.logLevel, addSource)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Trusted proxies.
+	app.trustedProxies, err = parseTrustedProxies(app.env.TRUSTED_PROXIES)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Path prefix the app is served under.
+	app.basePath, err = parseBasePath(app.env.BASE_PATH)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Trusted origins.
+	app.trustedOrigins, err = parseTrustedOrigins(app.env.TRUSTED_ORIGINS)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Share links. Short secrets are too easy to brute force.
+	if app.env.SHARE_SECRET != "" {
+		if len(app.env.SHARE_SECRET) < 32 {
+			app.logger.Error("SHARE_SECRET must be at least 32 characters")
+			os.Exit(1)
+		}
+		app.shareSecret = []byte(app.env.SHARE_SECRET)
+	}
+
+	app.shareLinkTTL, err = time.ParseDuration(app.env.SHARE_LINK_TTL)
+	if err != nil || app.shareLinkTTL <= 0 {
+		app.logger.Error(fmt.Sprintf("invalid SHARE_LINK_TTL %q", app.env.SHARE_LINK_TTL))
+		os.Exit(1)
+	}
+
+	// Request timeout.
+	app.requestTimeout, err = time.ParseDuration(app.env.REQUEST_TIMEOUT)
+	if err != nil || app.requestTimeout < 0 {
+		app.logger.Error(fmt.Sprintf("invalid REQUEST_TIMEOUT %q", app.env.REQUEST_TIMEOUT))
+		os.Exit(1)
+	}
+
+	// Expires soon threshold.
+	app.expiresSoonWithin, err = time.ParseDuration(app.env.EXPIRES_SOON)
+	if err != nil || app.expiresSoonWithin < 0 {
+		app.logger.Error(fmt.Sprintf("invalid EXPIRES_SOON %q", app.env.EXPIRES_SOON))
+		os.Exit(1)
+	}
+
+	// Maintenance mode. Held in an atomic so it can be flipped at runtime.
+	maintenance, err := strconv.ParseBool(app.env.MAINTENANCE_MODE)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid MAINTENANCE_MODE %q", app.env.MAINTENANCE_MODE))
+		os.Exit(1)
+	}
+	app.maintenance.Store(maintenance)
+
+	// Site notice. Held atomically so it can be changed while running.
+	app.siteNotice.Store(app.env.SITE_NOTICE)
+
+	// Listing limit cap.
+	app.maxListLimit, err = strconv.Atoi(app.env.MAX_LIST_LIMIT)
+	if err != nil || app.maxListLimit < 1 {
+		app.logger.Error(fmt.Sprintf("invalid MAX_LIST_LIMIT %q", app.env.MAX_LIST_LIMIT))
+		os.Exit(1)
+	}
+
+	// Query string limits.
+	app.maxQueryLength, err = strconv.Atoi(app.env.MAX_QUERY_LENGTH)
+	if err != nil || app.maxQueryLength < 1 {
+		app.logger.Error(fmt.Sprintf("invalid MAX_QUERY_LENGTH %q", app.env.MAX_QUERY_LENGTH))
+		os.Exit(1)
+	}
+
+	app.maxQueryParam, err = strconv.Atoi(app.env.MAX_QUERY_PARAM_LENGTH)
+	if err != nil || app.maxQueryParam < 1 {
+		app.logger.Error(fmt.Sprintf("invalid MAX_QUERY_PARAM_LENGTH %q", app.env.MAX_QUERY_PARAM_LENGTH))
+		os.Exit(1)
+	}
+
+	// Snippet content size.
+	app.maxContentBytes, err = strconv.Atoi(app.env.MAX_CONTENT_BYTES)
+	if err != nil || app.maxContentBytes < 1 {
+		app.logger.Error(fmt.Sprintf("invalid MAX_CONTENT_BYTES %q", app.env.MAX_CONTENT_BYTES))
+		os.Exit(1)
+	}
+
+	mediumText, err := strconv.ParseBool(app.env.SNIPPET_CONTENT_MEDIUMTEXT)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid SNIPPET_CONTENT_MEDIUMTEXT %q", app.env.SNIPPET_CONTENT_MEDIUMTEXT))
+		os.Exit(1)
+	}
+
+	preparedStatements, err := strconv.ParseBool(app.env.SNIPPET_PREPARED_STATEMENTS)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid SNIPPET_PREPARED_STATEMENTS %q", app.env.SNIPPET_PREPARED_STATEMENTS))
+		os.Exit(1)
+	}
+
+	columnBytes := models.TextColumnBytes
+	if mediumText {
+		columnBytes = models.MediumTextColumnBytes
+	}
+
+	// Never accept more than the column can store.
+	if app.maxContentBytes > columnBytes {
+		app.logger.Warn("MAX_CONTENT_BYTES exceeds the content column size, using the column size", "max_content_bytes", app.maxContentBytes, "column_bytes", columnBytes)
+		app.maxContentBytes = columnBytes
+	}
+
+	// Permitted snippet expiries, which the model checks too.
+	models.PermittedExpiries, err = parseExpiryDays(app.env.EXPIRY_DAYS)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Default snippet expiry.
+	app.defaultExpiry, err = strconv.Atoi(app.env.DEFAULT_EXPIRY_DAYS)
+	if err != nil || !validator.PermittedValue(app.defaultExpiry, models.PermittedExpiries...) {
+		app.logger.Error(fmt.Sprintf("invalid DEFAULT_EXPIRY_DAYS %q", app.env.DEFAULT_EXPIRY_DAYS))
+		os.Exit(1)
+	}
+
+	// Snippet quota.
+	app.snippetQuota, err = strconv.Atoi(app.env.SNIPPET_QUOTA)
+	if err != nil || app.snippetQuota < 0 {
+		app.logger.Error(fmt.Sprintf("invalid SNIPPET_QUOTA %q", app.env.SNIPPET_QUOTA))
+		os.Exit(1)
+	}
+
+	// Login lockout.
+	loginMaxAttempts, err := strconv.Atoi(app.env.LOGIN_MAX_ATTEMPTS)
+	if err != nil || loginMaxAttempts < 1 {
+		app.logger.Error(fmt.Sprintf("invalid LOGIN_MAX_ATTEMPTS %q", app.env.LOGIN_MAX_ATTEMPTS))
+		os.Exit(1)
+	}
+
+	loginLockoutWindow, err := time.ParseDuration(app.env.LOGIN_LOCKOUT_WINDOW)
+	if err != nil || loginLockoutWindow <= 0 {
+		app.logger.Error(fmt.Sprintf("invalid LOGIN_LOCKOUT_WINDOW %q", app.env.LOGIN_LOCKOUT_WINDOW))
+		os.Exit(1)
+	}
+
+	app.loginLockout = newLoginLockout(loginMaxAttempts, loginLockoutWindow)
+
 	// Init DB pool.
-	db, err := openDB(app.env.DSN)
+	attempts, err := strconv.Atoi(app.env.DB_CONNECT_ATTEMPTS)
+	if err != nil || attempts < 1 {
+		app.logger.Error(fmt.Sprintf("invalid DB_CONNECT_ATTEMPTS %q", app.env.DB_CONNECT_ATTEMPTS))
+		os.Exit(1)
+	}
+
+	// Database TLS. The DSNs are rewritten to use it, so they're logged as
+	// they're used.
+	app.env.DSN, err = dbTLSDSN(app.env.DSN, app.env.DB_TLS)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if app.env.READ_DSN != "" {
+		app.env.READ_DSN, err = dbTLSDSN(app.env.READ_DSN, app.env.DB_TLS)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// In check mode we only care that the DB is reachable, so report on it
+	// and exit before binding the port.
+	if *checkDB {
+		err = checkDatabase(app.logger, app.env.DSN, attempts)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+		app.logger.Info("database connection ok")
+		return
+	}
+
+	db, err := openDB(app.logger, app.env.DSN, attempts)
 	if err != nil {
 		app.logger.Error(err.Error())
 		os.Exit(1)
@@ -59,20 +424,185 @@ func main() {
 	// before the main() function exits.
 	defer db.Close()
 
+	publishDBStats(db)
+
+	// Keep an eye on the database for the readiness check. The ping interval
+	// backs off to this ceiling while the database is down.
+	const dbMonitorMaxInterval = 2 * time.Minute
+
+	monitorInterval, err := time.ParseDuration(app.env.DB_MONITOR_INTERVAL)
+	if err != nil || monitorInterval <= 0 {
+		app.logger.Error(fmt.Sprintf("invalid DB_MONITOR_INTERVAL %q", app.env.DB_MONITOR_INTERVAL))
+		os.Exit(1)
+	}
+	app.db = db
+	app.dbMonitor = newDBMonitor(app.logger, db.PingContext, monitorInterval, dbMonitorMaxInterval)
+	app.shutdown = make(chan struct{})
+
+	// Open the read replica pool, if one is configured.
+	var replica *sql.DB
+	if app.env.READ_DSN != "" {
+		replica, err = openDB(app.logger, app.env.READ_DSN, attempts)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		defer replica.Close()
+	}
+
 	// Initialize a new instance of SnippetModel and add it to the application
 	// dependencies.
-	app.snippets = &models.SnippetModel{DB: db}
+	snippets := &models.SnippetModel{DB: db, Replica: replica}
+	app.snippets = snippets
+	users := &models.UserModel{DB: db}
+	app.users = users
+	audit := &models.AuditModel{DB: db}
+	app.audit = audit
+	reports := &models.ReportModel{DB: db}
+	app.reports = reports
+	app.broadcaster = newBroadcaster()
+
+	// Log every model query in development, and slow ones wherever a
+	// threshold is set. Otherwise the hooks are left nil, which skips the
+	// timing altogether.
+	app.logAllQueries = app.env.ENV == "dev"
+
+	slowQueryMS, err := strconv.Atoi(app.env.SLOW_QUERY_MS)
+	if err != nil || slowQueryMS < 0 {
+		app.logger.Error(fmt.Sprintf("invalid SLOW_QUERY_MS %q", app.env.SLOW_QUERY_MS))
+		os.Exit(1)
+	}
+	app.slowQueryThreshold = time.Duration(slowQueryMS) * time.Millisecond
+
+	if app.logAllQueries || app.slowQueryThreshold > 0 {
+		snippets.QueryHook = app.logQuery
+		users.QueryHook = app.logQuery
+	}
+
+	// Rate limiting.
+	err = app.configureRateLimiter(db)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Reports are limited separately, and always, so the moderation queue
+	// can't be flooded.
+	app.reportLimiter = newRateLimiter(newMemoryRateLimitStore(), 10, time.Hour)
 
 	// Init form decoder.
+	// Indexed fields (e.g. "tags[3]") make the decoder allocate a slice up
+	// to the index, so keep that small.
 	app.formDecoder = form.NewDecoder()
+	app.formDecoder.SetMaxArraySize(maxFormArraySize)
 
 	// Seed database.
 	if app.env.ENV == "dev" {
-		err = app.snippets.SeedDatabase()
+		err = snippets.SeedDatabase()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		err = users.SeedDatabase()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		err = audit.SeedDatabase()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		err = reports.SeedDatabase()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		err = (&models.WorkspaceModel{DB: db}).SeedDatabase()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		err = (&models.RateLimitModel{DB: db}).SeedDatabase()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if mediumText {
+		err = snippets.UseMediumText()
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Optionally prepare the hottest snippet queries up front. This has to
+	// wait until the tables exist.
+	if preparedStatements {
+		prepared, err := models.NewPreparedSnippetModel(snippets)
+		if err != nil {
+			app.logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		defer prepared.Close()
+
+		app.snippets = prepared
+	}
+
+	// Optional cache in front of snippet lookups.
+	cacheSize, err := strconv.Atoi(app.env.SNIPPET_CACHE_SIZE)
+	if err != nil || cacheSize < 0 {
+		app.logger.Error(fmt.Sprintf("invalid SNIPPET_CACHE_SIZE %q", app.env.SNIPPET_CACHE_SIZE))
+		os.Exit(1)
+	}
+
+	if cacheSize > 0 {
+		cacheTTL, err := time.ParseDuration(app.env.SNIPPET_CACHE_TTL)
+		if err != nil || cacheTTL <= 0 {
+			app.logger.Error(fmt.Sprintf("invalid SNIPPET_CACHE_TTL %q", app.env.SNIPPET_CACHE_TTL))
+			os.Exit(1)
+		}
+
+		app.snippets = models.NewCachedSnippetModel(app.snippets, cacheSize, cacheTTL)
+	}
+
+	latestCacheTTL, err := time.ParseDuration(app.env.LATEST_CACHE_TTL)
+	if err != nil || latestCacheTTL < 0 {
+		app.logger.Error(fmt.Sprintf("invalid LATEST_CACHE_TTL %q", app.env.LATEST_CACHE_TTL))
+		os.Exit(1)
+	}
+
+	if latestCacheTTL > 0 {
+		app.snippets = models.NewLatestCachedSnippetModel(app.snippets, latestCacheTTL)
+	}
+
+	// Run the requested subcommand instead of the server.
+	switch subcommand {
+	case "create-admin":
+		err = app.createAdmin(subcommandArgs, os.Stderr)
+		if err != nil {
+			app.logger.Error(err.Error())
+			db.Close()
+			os.Exit(1)
+		}
+		return
+	case "backfill":
+		err = app.backfill(snippets, subcommandArgs, os.Stderr)
 		if err != nil {
 			app.logger.Error(err.Error())
+			db.Close()
 			os.Exit(1)
 		}
+		return
 	}
 
 	// Use the scs.New() function to initialize a new session manager. Then we
@@ -84,6 +614,28 @@ func main() {
 	sessionManager.Lifetime = 12 * time.Hour
 	app.sessionManager = sessionManager
 
+	// Apply the configured session cookie attributes.
+	err = app.configureSessionCookie()
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Display time zone. An unknown zone isn't worth refusing to start over,
+	// so fall back to UTC.
+	displayLocation, err = time.LoadLocation(app.env.DISPLAY_TZ)
+	if err != nil {
+		app.logger.Warn("invalid DISPLAY_TZ, using UTC", "display_tz", app.env.DISPLAY_TZ, "error", err.Error())
+		displayLocation = time.UTC
+	}
+
+	// HTML sanitization policy, used by the templates.
+	sanitizePolicy, err = newSanitizePolicy(app.env.SANITIZE_POLICY)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Init template cache.
 	app.templateCache, err = newTemplateCache()
 	if err != nil {
@@ -91,24 +643,145 @@ func main() {
 		os.Exit(1)
 	}
 
-	app.logger.Info(fmt.Sprintf("Start on %s:%s", app.env.HOST, app.env.PORT))
+	app.templateReload, err = strconv.ParseBool(app.env.TEMPLATE_RELOAD)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid TEMPLATE_RELOAD %q", app.env.TEMPLATE_RELOAD))
+		os.Exit(1)
+	}
+
+	app.logAssets, err = strconv.ParseBool(app.env.LOG_ASSET_REQUESTS)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid LOG_ASSET_REQUESTS %q", app.env.LOG_ASSET_REQUESTS))
+		os.Exit(1)
+	}
+
+	switch app.env.LOG_ACCESS_FORMAT {
+	case "slog", "combined", "both":
+		app.logAccessFormat = app.env.LOG_ACCESS_FORMAT
+		app.accessLog = os.Stdout
+	default:
+		app.logger.Error(fmt.Sprintf("invalid LOG_ACCESS_FORMAT %q", app.env.LOG_ACCESS_FORMAT))
+		os.Exit(1)
+	}
+
+	app.pprofEnabled, err = strconv.ParseBool(app.env.PPROF_ENABLED)
+	if err != nil {
+		app.logger.Error(fmt.Sprintf("invalid PPROF_ENABLED %q", app.env.PPROF_ENABLED))
+		os.Exit(1)
+	}
+
+	switch app.env.HTTP2 {
+	case "off", "on", "h2c":
+	default:
+		app.logger.Error(fmt.Sprintf("invalid HTTP2 %q", app.env.HTTP2))
+		os.Exit(1)
+	}
+
+	info := getBuildInfo()
+	app.logger.Info("build", "version", info.Version, "commit", info.Commit, "build_time", info.BuildTime)
+
+	addr := fmt.Sprintf("%s:%s", app.env.HOST, app.env.PORT)
+
+	// Summarize the effective configuration, so operators can check what's
+	// running. A max_open_conns of 0 means the pool is unlimited.
+	app.logger.Info("starting server",
+		"env", app.env.ENV,
+		"addr", addr,
+		"base_path", app.basePath,
+		"tls", app.tlsEnabled(),
+		"http2", app.env.HTTP2,
+		"dsn", redactDSN(app.env.DSN),
+		"read_dsn", redactDSN(app.env.READ_DSN),
+		"max_open_conns", db.Stats().MaxOpenConnections,
+		"read_max_open_conns", maxOpenConns(replica),
+		"maintenance", app.maintenance.Load(),
+	)
 
-	errServer := http.ListenAndServe(fmt.Sprintf("%s:%s", app.env.HOST, app.env.PORT), app.routes())
-	log.Fatal(errServer)
+	err = app.serve(addr)
+	if err != nil {
+		app.logger.Error(err.Error())
+		os.Exit(1)
+	}
 }
 
 // The openDB() function wraps sql.Open() and returns a sql.DB connection pool
-// for a given DSN.
-func openDB(dsn string) (*sql.DB, error) {
+// for a given DSN. The database may still be starting up (e.g. when launched
+// alongside the app), so the initial ping is retried with backoff. DSN errors
+// are returned straight away as retrying won't fix them.
+func openDB(logger *slog.Logger, dsn string, attempts int) (*sql.DB, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Ping()
+	err = pingWithRetry(logger, db.Ping, attempts, 500*time.Millisecond)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// Check that the database at dsn is reachable, for -check-db. The pool is
+// opened (which pings it, with retries) and closed again straight away.
+func checkDatabase(logger *slog.Logger, dsn string, attempts int) error {
+	db, err := openDB(logger, dsn, attempts)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// Return the DSN with its password masked, for logging. A DSN which can't be
+// parsed is left out entirely, as it may hold the password anywhere.
+func redactDSN(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "[invalid]"
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = "xxxxx"
+	}
+
+	return cfg.FormatDSN()
+}
+
+// Return the connection limit of an optional pool, 0 for none or unlimited.
+func maxOpenConns(db *sql.DB) int {
+	if db == nil {
+		return 0
+	}
+	return db.Stats().MaxOpenConnections
+}
+
+// Call ping until it succeeds or the attempts run out, doubling the wait
+// between attempts (capped at 10 seconds). Each failed attempt is logged at
+// Warn level and the last error is returned if all of them fail.
+func pingWithRetry(logger *slog.Logger, ping func() error, attempts int, backoff time.Duration) error {
+	const maxBackoff = 10 * time.Second
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = ping()
+		if err == nil {
+			return nil
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		logger.Warn("database not reachable, retrying", "attempt", attempt, "wait", backoff.String(), "error", err.Error())
+		time.Sleep(backoff)
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	return err
+}
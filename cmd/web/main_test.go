@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDatabase(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name string
+		dsn  string
+	}{
+		{"Invalid DSN", "not a dsn"},
+		{"Unreachable server", "web:pass@tcp(127.0.0.1:1)/snippetbox?timeout=1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDatabase(logger, tt.dsn, 1)
+			if err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
+
+func TestPingWithRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	errDown := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		wantCalls int
+		wantErr   error
+	}{
+		{"First try", 0, 3, 1, nil},
+		{"Fails then succeeds", 2, 3, 3, nil},
+		{"Always fails", 5, 3, 3, errDown},
+		{"Single attempt", 1, 1, 1, errDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			ping := func() error {
+				calls++
+				if calls <= tt.failures {
+					return errDown
+				}
+				return nil
+			}
+
+			err := pingWithRetry(logger, ping, tt.attempts, time.Millisecond)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d pings; want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "Password",
+			dsn:  "web:s3cr3t@tcp(db.internal:3306)/snippetbox?parseTime=true",
+			want: "web:xxxxx@tcp(db.internal:3306)/snippetbox?parseTime=true",
+		},
+		{
+			name: "Password with special characters",
+			dsn:  "web:p@ss:w/rd@tcp(db.internal:3306)/snippetbox",
+			want: "web:xxxxx@tcp(db.internal:3306)/snippetbox",
+		},
+		{
+			name: "No password",
+			dsn:  "web@tcp(db.internal:3306)/snippetbox",
+			want: "web@tcp(db.internal:3306)/snippetbox",
+		},
+		{
+			name: "Empty",
+			dsn:  "",
+			want: "",
+		},
+		{
+			name: "Invalid",
+			dsn:  "web:s3cr3t@tcp(db.internal:3306)",
+			want: "[invalid]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactDSN(tt.dsn)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+			if strings.Contains(got, "s3cr3t") || strings.Contains(got, "w/rd") {
+				t.Errorf("got %q; want the password masked", got)
+			}
+		})
+	}
+}
+
+func TestMaxOpenConns(t *testing.T) {
+	if got := maxOpenConns(nil); got != 0 {
+		t.Errorf("without a pool got %d; want 0", got)
+	}
+
+	db, err := sql.Open("mysql", "web:pass@tcp(localhost:3306)/snippetbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.SetMaxOpenConns(25)
+
+	if got := maxOpenConns(db); got != 25 {
+		t.Errorf("got %d; want 25", got)
+	}
+}
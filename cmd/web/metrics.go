@@ -0,0 +1,20 @@
+package main
+
+import (
+	"database/sql"
+	"expvar"
+)
+
+// Process-wide counters published via expvar at /debug/vars.
+var (
+	totalRequests   = expvar.NewInt("total_requests")
+	snippetsCreated = expvar.NewInt("snippets_created")
+)
+
+// Publish the connection pool statistics. They're computed on each read of
+// /debug/vars rather than being stored.
+func publishDBStats(db *sql.DB) {
+	expvar.Publish("database", expvar.Func(func() any {
+		return db.Stats()
+	}))
+}
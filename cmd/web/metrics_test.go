@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDebugVars(t *testing.T) {
+	t.Run("Not in production", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+
+		code, _, _ := ts.get(t, "/debug/vars")
+		if code != http.StatusNotFound {
+			t.Errorf("got status %d; want %d", code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("In development", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.env.ENV = "dev"
+		ts := newTestServer(t, app.routes())
+
+		vars := func() map[string]json.RawMessage {
+			t.Helper()
+
+			code, _, body := ts.get(t, "/debug/vars")
+			if code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", code, http.StatusOK)
+			}
+
+			var vars map[string]json.RawMessage
+			err := json.Unmarshal([]byte(body), &vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return vars
+		}
+
+		before := vars()
+		for _, name := range []string{"total_requests", "snippets_created"} {
+			if _, ok := before[name]; !ok {
+				t.Errorf("want %s to be published", name)
+			}
+		}
+
+		ts.get(t, "/")
+
+		// The home page and the second read itself are both counted.
+		var requestsBefore, requestsAfter int
+		json.Unmarshal(before["total_requests"], &requestsBefore)
+		json.Unmarshal(vars()["total_requests"], &requestsAfter)
+
+		if requestsAfter != requestsBefore+2 {
+			t.Errorf("got total_requests %d; want %d", requestsAfter, requestsBefore+2)
+		}
+	})
+}
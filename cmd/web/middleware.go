@@ -1,8 +1,19 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+	"github.com/justinas/nosurf"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -16,18 +27,89 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// Count every request for the total_requests expvar.
+func countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		totalRequests.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The noCache middleware stops browsers and intermediaries from storing the
+// response. It's meant for dynamic pages (which carry per-user data and CSRF
+// tokens), not static assets, so apply it per route group.
+func noCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requestID middleware gives each request a random id, added to the
+// request logger (so everything logged for the request, its queries
+// included, can be tied together) and sent back in the X-Request-Id header.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 8)
+		_, err := rand.Read(b)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		id := hex.EncodeToString(b)
+
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, app.withLogAttrs(r, "request_id", id))
+	})
+}
+
+// Requests under these paths aren't logged by logRequest.
+var unloggedPaths = []string{
+	"/debug/pprof/",
+}
+
+// The logRequest middleware logs each request as set by LOG_ACCESS_FORMAT: a
+// structured entry as it comes in, and/or a Combined Log Format line once it
+// has been answered.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range unloggedPaths {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if !app.logAssets && isAssetRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		var (
-			ip     = r.RemoteAddr
+			ip     = app.realIP(r)
 			proto  = r.Proto
 			method = r.Method
 			uri    = r.URL.RequestURI()
 		)
 
-		app.logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+		if app.logAccessFormat != "combined" {
+			app.requestLogger(r).Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+		}
 
-		next.ServeHTTP(w, r)
+		if app.logAccessFormat != "combined" && app.logAccessFormat != "both" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The combined format line needs the status and size, so it's
+		// written once the handler has finished.
+		start := time.Now()
+		rec := &accessRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		io.WriteString(app.accessLog, combinedLogLine(ip, start, r, rec.status, rec.bytes))
 	})
 }
 
@@ -50,3 +132,271 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Create a NoSurf middleware function which uses a customized CSRF cookie with
+// the HttpOnly attribute set, and Path/Secure matching the session cookie.
+// Every state-changing request passing through it must carry the matching
+// token in a "csrf_token" form field.
+func (app *application) noSurf(next http.Handler) http.Handler {
+	csrfHandler := nosurf.New(next)
+	csrfHandler.SetBaseCookie(http.Cookie{
+		HttpOnly: true,
+		Path:     app.sessionManager.Cookie.Path,
+		Secure:   app.sessionManager.Cookie.Secure,
+	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(app.csrfFailure))
+
+	return csrfHandler
+}
+
+// Respond to a request which failed the CSRF check. A snippet submission cut
+// off by limitSnippetBody loses its token along with the rest of the form,
+// so it ends up here too; the user is told it was too large rather than
+// getting a bare 400.
+func (app *application) csrfFailure(w http.ResponseWriter, r *http.Request) {
+	if body, ok := r.Body.(*limitedBody); ok && body.exceeded {
+		app.snippetTooLarge(w, r)
+		return
+	}
+
+	app.clientError(w, http.StatusBadRequest)
+}
+
+// The authenticate middleware checks the session for an authenticated user ID
+// and, if that user still exists, marks the request context as authenticated
+// (and as admin, for admin users) and records the user's workspace. A session
+// pointing at a user who has since been deleted is cleaned up.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.users.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+				next.ServeHTTP(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		r = contextSetAuthenticated(r, true)
+		r = contextSetUserID(r, user.ID)
+		r = contextSetAdmin(r, user.IsAdmin)
+		r = contextSetWorkspaceID(r, user.WorkspaceID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The authenticateToken middleware is the API's counterpart to authenticate.
+// It requires an "Authorization: Bearer <token>" header carrying one of the
+// user's API tokens, and answers 401 Unauthorized when it's missing, unknown
+// or revoked.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			app.invalidTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.users.AuthenticateToken(strings.TrimSpace(token))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidToken) {
+				app.invalidTokenResponse(w, r)
+			} else {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = contextSetAuthenticated(r, true)
+		r = contextSetUserID(r, user.ID)
+		r = contextSetAdmin(r, user.IsAdmin)
+		r = contextSetWorkspaceID(r, user.WorkspaceID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthentication middleware redirects anonymous users to the login
+// page. It relies on authenticate having run first.
+func (app *application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAdmin middleware answers 403 Forbidden to anyone who isn't an
+// admin. It goes after requireAuthentication, so anonymous users are sent to
+// the login page first.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAdmin(r) {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// How long clients are asked to wait during maintenance, in seconds.
+const maintenanceRetryAfter = 300
+
+// Pages which stay up during maintenance, so that admins can still log in.
+// Static files and health checks aren't behind maintenanceMode at all.
+var maintenanceExemptPaths = []string{
+	"/user/login",
+}
+
+// The maintenanceMode middleware answers every request with a 503 maintenance
+// page while maintenance mode is switched on, or a JSON error for the API.
+// Admins can still use the site. It relies on authenticate (or
+// authenticateToken) having run first.
+func (app *application) maintenanceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.maintenance.Load() || app.isAdmin(r) || slices.Contains(maintenanceExemptPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if isAPIRequest(r) {
+			app.retryLaterResponse(w, r, http.StatusServiceUnavailable, "the service is down for maintenance", maintenanceRetryAfter)
+			return
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+		app.render(w, r, http.StatusServiceUnavailable, "maintenance.tmpl", app.newTemplateData(r))
+	})
+}
+
+// The canonicalHost middleware redirects (301) any request which didn't arrive
+// over https or was made to a different host to https://CANONICAL_HOST. When
+// the request comes through a trusted proxy the scheme is taken from
+// X-Forwarded-Proto. It does nothing when no canonical host is configured,
+// and health checks are let through untouched so probes hitting the app
+// directly keep working.
+func (app *application) canonicalHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := app.env.CANONICAL_HOST
+		if host == "" || isHealthCheck(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if app.requestScheme(r) != "https" || !strings.EqualFold(r.Host, host) {
+			http.Redirect(w, r, "https://"+host+app.basePath+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The body of the 503 sent when a request times out.
+const timeoutMessage = "Sorry, this request took too long. Please try again."
+
+// Paths which may legitimately run for longer than the request timeout (e.g.
+// streaming responses) and so bypass the timeout middleware.
+var timeoutExemptPaths = []string{
+	"/debug/",
+	"/events",
+}
+
+// The timeout middleware wraps the handler in http.TimeoutHandler, which
+// cancels the request context and sends a 503 if the handler hasn't finished
+// within the configured request timeout.
+func (app *application) timeout(next http.Handler) http.Handler {
+	if app.requestTimeout == 0 {
+		return next
+	}
+
+	timeoutHandler := http.TimeoutHandler(next, app.requestTimeout, timeoutMessage)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range timeoutExemptPaths {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		timeoutHandler.ServeHTTP(w, r)
+	})
+}
+
+// Wrap a single handler with its own deadline, for routes which should give
+// up sooner than the global request timeout. The request context passed down
+// is cancelled after d, and a 503 is sent if the handler hasn't finished by
+// then. A longer d than the global timeout has no effect unless the route is
+// also in timeoutExemptPaths.
+func withTimeout(d time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	return http.TimeoutHandler(h, d, timeoutMessage).ServeHTTP
+}
+
+// Cap the size of snippet form submissions. It has to run before noSurf,
+// which parses the form (uploads included) to find the CSRF token. The
+// allowance is the content limit, twice over since a submission may carry
+// both a file and the textarea, plus room for the other fields.
+func (app *application) limitSnippetBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, int64(2*app.maxContentBytes+maxUploadMemory))}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// A limitedBody records whether reading the request body ran into the
+// http.MaxBytesReader limit, since the form parsing which hits it (in
+// noSurf) drops the error.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		b.exceeded = true
+	}
+
+	return n, err
+}
+
+// The limitQuery middleware rejects requests with an overlong query string
+// (414 URI Too Long) or any single query parameter value over the limit (400
+// Bad Request), before handlers parse them or pass them on to the database.
+func (app *application) limitQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.RawQuery) > app.maxQueryLength {
+			app.clientError(w, http.StatusRequestURITooLong)
+			return
+		}
+
+		for _, values := range r.URL.Query() {
+			for _, value := range values {
+				if len(value) > app.maxQueryParam {
+					app.clientError(w, http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
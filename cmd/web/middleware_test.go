@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models/mocks"
+)
+
+func TestAuthenticateToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		revoke        bool
+		wantCode      int
+	}{
+		{
+			name:          "Valid token",
+			authorization: "Bearer " + mocks.MockAPIToken,
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "Unknown token",
+			authorization: "Bearer not-a-token",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Revoked token",
+			authorization: "Bearer " + mocks.MockAPIToken,
+			revoke:        true,
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong scheme",
+			authorization: "Token " + mocks.MockAPIToken,
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Empty token",
+			authorization: "Bearer ",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:     "Missing header",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			if tt.revoke {
+				err := app.users.RevokeAPITokens(1)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var userID int
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID = app.authenticatedUserID(r)
+				w.Write([]byte("OK"))
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/snippets", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			app.authenticateToken(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+
+			if tt.wantCode == http.StatusUnauthorized {
+				if got := rr.Header().Get("WWW-Authenticate"); got != "Bearer" {
+					t.Errorf("got WWW-Authenticate %q; want %q", got, "Bearer")
+				}
+				return
+			}
+
+			if userID != 1 {
+				t.Errorf("got authenticated user %d; want 1", userID)
+			}
+		})
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		maintenance bool
+		urlPath     string
+		wantCode    int
+	}{
+		{"Disabled", false, "/", http.StatusOK},
+		{"Enabled", true, "/", http.StatusServiceUnavailable},
+		{"Enabled API", true, "/api/v1/snippets", http.StatusServiceUnavailable},
+		{"Enabled login page", true, "/user/login", http.StatusOK},
+		{"Enabled health check", true, "/healthz", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.maintenance.Store(tt.maintenance)
+			ts := newTestServer(t, app.routes())
+
+			code, headers, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if code != http.StatusServiceUnavailable {
+				return
+			}
+			if got := headers.Get("Retry-After"); got != "300" {
+				t.Errorf("got Retry-After %q; want %q", got, "300")
+			}
+
+			// The API answers in JSON, everything else with the HTML page.
+			if !isAPIRequest(httptest.NewRequest(http.MethodGet, tt.urlPath, nil)) {
+				if !strings.Contains(headers.Get("Content-Type"), "text/html") {
+					t.Errorf("got Content-Type %q; want HTML", headers.Get("Content-Type"))
+				}
+				return
+			}
+
+			var got apiError
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			want := apiError{Error: "the service is down for maintenance", RetryAfter: 300}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got body %+v; want %+v", got, want)
+			}
+		})
+	}
+
+	t.Run("Enabled login", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.maintenance.Store(true)
+		ts := newTestServer(t, app.routes())
+
+		// Fails the test unless the login form is shown and accepted.
+		ts.login(t)
+	})
+
+	t.Run("Enabled admin", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.maintenance.Store(true)
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		})
+
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = contextSetAdmin(r, true)
+
+		app.maintenanceMode(next).ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("got status %d; want %d", rr.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestCanonicalHost(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		wantCode   int
+	}{
+		{"Trusted proxy, https", "10.0.0.1:4000", "https", http.StatusOK},
+		{"Trusted proxy, http", "10.0.0.1:4000", "http", http.StatusMovedPermanently},
+		{"Untrusted peer, spoofed https", "203.0.113.7:4000", "https", http.StatusMovedPermanently},
+		{"Untrusted peer, no header", "203.0.113.7:4000", "", http.StatusMovedPermanently},
+	}
+
+	app := newTestApplication(t)
+	app.env.CANONICAL_HOST = "snippetbox.example.com"
+
+	var err error
+	app.trustedProxies, err = parseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "http://snippetbox.example.com/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			app.canonicalHost(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	t.Run("Every layer runs", func(t *testing.T) {
+		code, headers, body := ts.get(t, "/user/login")
+
+		if code != http.StatusOK {
+			t.Fatalf("got status %d; want %d", code, http.StatusOK)
+		}
+
+		// secureHeaders, from the standard chain.
+		if got := headers.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("got X-Content-Type-Options %q; want %q", got, "nosniff")
+		}
+		// noCache, from the dynamic chain.
+		if got := headers.Get("Cache-Control"); got != "no-store" {
+			t.Errorf("got Cache-Control %q; want %q", got, "no-store")
+		}
+		// noSurf ran before the handler, which rendered its token.
+		extractCSRFToken(t, body)
+	})
+
+	t.Run("Later layers stop the request", func(t *testing.T) {
+		// Without a CSRF token noSurf turns the request away, but the headers
+		// set by the middleware before it are already in place.
+		code, headers, _ := ts.postForm(t, "/user/login", nil)
+
+		if code != http.StatusBadRequest {
+			t.Fatalf("got status %d; want %d", code, http.StatusBadRequest)
+		}
+		if got := headers.Get("X-Frame-Options"); got != "deny" {
+			t.Errorf("got X-Frame-Options %q; want %q", got, "deny")
+		}
+		if got := headers.Get("Cache-Control"); got != "no-store" {
+			t.Errorf("got Cache-Control %q; want %q", got, "no-store")
+		}
+	})
+
+	t.Run("Panics are recovered", func(t *testing.T) {
+		panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oops")
+		})
+
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		app.recoverPanic(app.logRequest(secureHeaders(panicking))).ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("got status %d; want %d", rr.Code, http.StatusInternalServerError)
+		}
+		if got := rr.Header().Get("Connection"); got != "close" {
+			t.Errorf("got Connection %q; want %q", got, "close")
+		}
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name              string
+		sessionUserID     int
+		wantAuthenticated bool
+		wantSessionKept   bool
+	}{
+		{"Authenticated", 1, true, true},
+		{"Anonymous", 0, false, false},
+		{"Deleted user", 99, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			ctx, err := app.sessionManager.Load(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sessionUserID != 0 {
+				app.sessionManager.Put(ctx, "authenticatedUserID", tt.sessionUserID)
+			}
+
+			var authenticated bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated = app.isAuthenticated(r)
+				w.Write([]byte("OK"))
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			app.authenticate(next).ServeHTTP(rr, r)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+			}
+			if authenticated != tt.wantAuthenticated {
+				t.Errorf("got authenticated %t; want %t", authenticated, tt.wantAuthenticated)
+			}
+			if kept := app.sessionManager.Exists(ctx, "authenticatedUserID"); kept != tt.wantSessionKept {
+				t.Errorf("got session user kept %t; want %t", kept, tt.wantSessionKept)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		wantCode int
+	}{
+		{"Within the deadline", 0, http.StatusOK},
+		{"Past the deadline", time.Second, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The handler runs in its own goroutine, which may still be
+			// finishing after the 503 is sent.
+			ctxErr := make(chan error, 1)
+			h := func(w http.ResponseWriter, r *http.Request) {
+				// Stand in for a slow query, which gives up once the
+				// request's context is done.
+				select {
+				case <-time.After(tt.delay):
+					ctxErr <- nil
+					w.Write([]byte("OK"))
+				case <-r.Context().Done():
+					ctxErr <- r.Context().Err()
+				}
+			}
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			withTimeout(20*time.Millisecond, h).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusServiceUnavailable {
+				return
+			}
+
+			if !strings.Contains(rr.Body.String(), timeoutMessage) {
+				t.Errorf("got body %q; want the timeout message", rr.Body.String())
+			}
+			if err := <-ctxErr; !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got handler context error %v; want %v", err, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Slow handler", "/", http.StatusServiceUnavailable},
+		{"Exempt path", "/events", http.StatusOK},
+	}
+
+	app := newTestApplication(t)
+	app.requestTimeout = 20 * time.Millisecond
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			w.Write([]byte("OK"))
+		case <-r.Context().Done():
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.urlPath, nil)
+
+			app.timeout(slow).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusServiceUnavailable && !strings.Contains(rr.Body.String(), timeoutMessage) {
+				t.Errorf("got body %q; want the timeout message", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t)
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		wantNoCache bool
+	}{
+		{"Protected route", "/user/tokens", true},
+		{"Static asset", "/static/css/main.css", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, _ := ts.get(t, tt.urlPath)
+			if code != http.StatusOK {
+				t.Fatalf("got status %d; want %d", code, http.StatusOK)
+			}
+
+			gotNoCache := headers.Get("Cache-Control") == "no-store" && headers.Get("Pragma") == "no-cache"
+			if gotNoCache != tt.wantNoCache {
+				t.Errorf("got Cache-Control %q and Pragma %q; want no-cache headers %t", headers.Get("Cache-Control"), headers.Get("Pragma"), tt.wantNoCache)
+			}
+		})
+	}
+}
+
+func TestLimitQuery(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Acceptable search", "/?q=pond", http.StatusOK},
+		{"Parameter at the limit", "/?q=" + strings.Repeat("a", 256), http.StatusOK},
+		{"Oversized parameter", "/?q=" + strings.Repeat("a", 257), http.StatusBadRequest},
+		{"Oversized query string", "/?" + strings.Repeat("a=1&", 600), http.StatusRequestURITooLong},
+		{"Oversized API query string", "/api/v1/snippets?" + strings.Repeat("a=1&", 600), http.StatusRequestURITooLong},
+		{"Unlimited route", "/healthz?" + strings.Repeat("a=1&", 600), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
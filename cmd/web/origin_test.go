@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyOrigin(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		origin   string
+		referer  string
+		wantCode int
+	}{
+		{
+			name:     "Same origin",
+			method:   http.MethodPost,
+			origin:   "https://snippetbox.example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Same origin referer",
+			method:   http.MethodPost,
+			referer:  "https://snippetbox.example.com/snippet/create",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Trusted origin",
+			method:   http.MethodPost,
+			origin:   "https://admin.example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Cross origin",
+			method:   http.MethodPost,
+			origin:   "https://evil.example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Cross origin referer",
+			method:   http.MethodPost,
+			referer:  "https://evil.example.com/page",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Opaque origin",
+			method:   http.MethodPost,
+			origin:   "null",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Missing headers",
+			method:   http.MethodPost,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Cross origin GET",
+			method:   http.MethodGet,
+			origin:   "https://evil.example.com",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	app := newTestApplication(t)
+	app.trustedOrigins = []string{"https://admin.example.com"}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "https://snippetbox.example.com/snippet/create", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+
+			app.verifyOrigin(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestVerifyOriginScheme(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		remoteAddr     string
+		forwardedProto string
+		origin         string
+		wantCode       int
+	}{
+		{
+			name:     "Plain HTTP",
+			url:      "http://snippetbox.example.com/snippet/create",
+			origin:   "http://snippetbox.example.com",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "HTTP origin on HTTPS",
+			url:      "https://snippetbox.example.com/snippet/create",
+			origin:   "http://snippetbox.example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "HTTPS origin on HTTP",
+			url:      "http://snippetbox.example.com/snippet/create",
+			origin:   "https://snippetbox.example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:           "Trusted proxy terminating TLS",
+			url:            "http://snippetbox.example.com/snippet/create",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedProto: "https",
+			origin:         "https://snippetbox.example.com",
+			wantCode:       http.StatusOK,
+		},
+		{
+			name:           "HTTP origin behind a TLS proxy",
+			url:            "http://snippetbox.example.com/snippet/create",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedProto: "https",
+			origin:         "http://snippetbox.example.com",
+			wantCode:       http.StatusForbidden,
+		},
+		{
+			name:           "Untrusted forwarded proto",
+			url:            "http://snippetbox.example.com/snippet/create",
+			remoteAddr:     "203.0.113.5:1234",
+			forwardedProto: "https",
+			origin:         "https://snippetbox.example.com",
+			wantCode:       http.StatusForbidden,
+		},
+	}
+
+	app := newTestApplication(t)
+
+	var err error
+	app.trustedProxies, err = parseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwardedProto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			r.Header.Set("Origin", tt.origin)
+
+			app.verifyOrigin(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
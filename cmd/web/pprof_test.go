@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPprof(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		login        bool
+		admin        bool
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:     "Disabled",
+			login:    true,
+			admin:    true,
+			urlPath:  "/debug/pprof/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Anonymous",
+			enabled:      true,
+			urlPath:      "/debug/pprof/",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:     "Not an admin",
+			enabled:  true,
+			login:    true,
+			urlPath:  "/debug/pprof/",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Admin index",
+			enabled:  true,
+			login:    true,
+			admin:    true,
+			urlPath:  "/debug/pprof/",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Admin named profile",
+			enabled:  true,
+			login:    true,
+			admin:    true,
+			urlPath:  "/debug/pprof/cmdline",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+
+			app := newTestApplication(t)
+			app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+			app.pprofEnabled = tt.enabled
+			ts := newTestServer(t, app.routes())
+
+			if tt.login {
+				ts.login(t)
+			}
+			if tt.admin {
+				app.users.SetAdmin(1, true)
+			}
+
+			code, headers, _ := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := headers.Get("Location"); got != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", got, tt.wantLocation)
+			}
+
+			// Profiling requests are left out of the request log.
+			if strings.Contains(logs.String(), "/debug/pprof") {
+				t.Errorf("want no log entries for %s; got %q", tt.urlPath, logs.String())
+			}
+		})
+	}
+}
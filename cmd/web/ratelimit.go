@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+// A rateLimitStore keeps hit counters per key and fixed window. The memory
+// store suits a single instance; the MySQL store (models.RateLimitModel)
+// shares counts between instances.
+type rateLimitStore interface {
+	Hit(key string, windowStart, previousStart time.Time) (current int, previous int, err error)
+	Cleanup(before time.Time) error
+}
+
+// The rateLimiter allows up to limit requests per key per window, using a
+// sliding window estimate: the current window's count plus the previous
+// window's count weighted by how much of it still overlaps the last window.
+type rateLimiter struct {
+	store  rateLimitStore
+	limit  atomic.Int64
+	window time.Duration
+}
+
+// Create a rateLimiter allowing limit requests per key per window.
+func newRateLimiter(store rateLimitStore, limit int, window time.Duration) *rateLimiter {
+	l := &rateLimiter{store: store, window: window}
+	l.limit.Store(int64(limit))
+	return l
+}
+
+// Record a hit for key and report whether it's allowed. When it isn't, the
+// returned duration is how long the client should wait before retrying. A
+// limit of 0 (set by a config reload) allows everything.
+func (l *rateLimiter) Allow(key string) (bool, time.Duration, error) {
+	limit := l.limit.Load()
+	if limit == 0 {
+		return true, 0, nil
+	}
+
+	now := time.Now()
+	windowStart := now.Truncate(l.window)
+
+	current, previous, err := l.store.Hit(key, windowStart, windowStart.Add(-l.window))
+	if err != nil {
+		return false, 0, err
+	}
+
+	elapsed := now.Sub(windowStart)
+	weight := 1 - float64(elapsed)/float64(l.window)
+	estimate := float64(previous)*weight + float64(current)
+
+	if estimate > float64(limit) {
+		return false, l.window - elapsed, nil
+	}
+
+	return true, 0, nil
+}
+
+// Periodically drop counters that can no longer affect a decision, until ctx
+// is cancelled.
+func (l *rateLimiter) cleanup(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := l.store.Cleanup(time.Now().Truncate(l.window).Add(-l.window))
+		if err != nil {
+			onError(err)
+		}
+	}
+}
+
+// The in-memory store, keyed by rate limit key and then window start.
+type memoryRateLimitStore struct {
+	mu     sync.Mutex
+	counts map[string]map[time.Time]int
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{counts: make(map[string]map[time.Time]int)}
+}
+
+func (s *memoryRateLimitStore) Hit(key string, windowStart, previousStart time.Time) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, ok := s.counts[key]
+	if !ok {
+		windows = make(map[time.Time]int)
+		s.counts[key] = windows
+	}
+
+	windows[windowStart]++
+
+	return windows[windowStart], windows[previousStart], nil
+}
+
+func (s *memoryRateLimitStore) Cleanup(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, windows := range s.counts {
+		for start := range windows {
+			if start.Before(before) {
+				delete(windows, start)
+			}
+		}
+		if len(windows) == 0 {
+			delete(s.counts, key)
+		}
+	}
+
+	return nil
+}
+
+// Set up app.rateLimiter from the RATE_LIMIT_* settings, and start the
+// goroutine which clears out old counters.
+func (app *application) configureRateLimiter(db *sql.DB) error {
+	limit, err := strconv.Atoi(app.env.RATE_LIMIT_REQUESTS)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid RATE_LIMIT_REQUESTS %q", app.env.RATE_LIMIT_REQUESTS)
+	}
+
+	if limit == 0 {
+		return nil
+	}
+
+	window, err := time.ParseDuration(app.env.RATE_LIMIT_WINDOW)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid RATE_LIMIT_WINDOW %q", app.env.RATE_LIMIT_WINDOW)
+	}
+
+	var store rateLimitStore
+
+	switch app.env.RATE_LIMIT_STORE {
+	case "memory":
+		store = newMemoryRateLimitStore()
+	case "mysql":
+		// Window starts are stored to the second, so shorter windows would
+		// all share one counter and never reset.
+		if window%time.Second != 0 {
+			return fmt.Errorf("invalid RATE_LIMIT_WINDOW %q: the mysql store needs a whole number of seconds", app.env.RATE_LIMIT_WINDOW)
+		}
+		store = &models.RateLimitModel{DB: db}
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_STORE %q", app.env.RATE_LIMIT_STORE)
+	}
+
+	app.rateLimiter = newRateLimiter(store, limit, window)
+
+	return nil
+}
+
+// The rateLimit middleware limits requests per client IP and responds with
+// 429 Too Many Requests once the limit is reached. It does nothing when rate
+// limiting isn't configured.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	if app.rateLimiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Load balancer health checks shouldn't use up anyone's allowance.
+		if isHealthCheck(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, retryAfter, err := app.rateLimiter.Allow(app.realIP(r))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if isAPIRequest(r) {
+				app.retryLaterResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded", seconds)
+				return
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			app.clientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
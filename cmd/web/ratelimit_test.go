@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterCleanupStops(t *testing.T) {
+	l := newRateLimiter(newMemoryRateLimitStore(), 10, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		l.cleanup(ctx, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	// Let it run a few times before cancelling.
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup still running after the context was cancelled")
+	}
+}
+
+func TestMemoryRateLimitStoreWindows(t *testing.T) {
+	s := newMemoryRateLimitStore()
+
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(time.Minute)
+
+	for want := 1; want <= 3; want++ {
+		current, previous, err := s.Hit("1.2.3.4", first, first.Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current != want || previous != 0 {
+			t.Errorf("got %d, %d; want %d, 0", current, previous, want)
+		}
+	}
+
+	// A new window starts counting again, with the last one as previous.
+	current, previous, err := s.Hit("1.2.3.4", second, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 1 || previous != 3 {
+		t.Errorf("new window: got %d, %d; want 1, 3", current, previous)
+	}
+
+	// Other keys have their own counters.
+	current, _, err = s.Hit("5.6.7.8", second, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 1 {
+		t.Errorf("other key: got %d; want 1", current)
+	}
+
+	err = s.Cleanup(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.counts["1.2.3.4"][first]; ok {
+		t.Error("window before the cleanup time was kept")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := newRateLimiter(newMemoryRateLimitStore(), 3, time.Hour)
+
+	for i := 1; i <= 3; i++ {
+		allowed, _, err := l.Allow("1.2.3.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed {
+			t.Fatalf("hit %d: got denied; want allowed", i)
+		}
+	}
+
+	allowed, retryAfter, err := l.Allow("1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Error("hit 4: got allowed; want denied")
+	}
+	if retryAfter <= 0 || retryAfter > time.Hour {
+		t.Errorf("got retry after %v; want within the window", retryAfter)
+	}
+
+	allowed, _, err = l.Allow("5.6.7.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Error("other key: got denied; want allowed")
+	}
+}
+
+func TestConfigureRateLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		store   string
+		window  string
+		wantErr bool
+	}{
+		{name: "Memory", store: "memory", window: "1m"},
+		{name: "Memory sub-second", store: "memory", window: "500ms"},
+		{name: "MySQL", store: "mysql", window: "1m"},
+		{name: "MySQL sub-second", store: "mysql", window: "500ms", wantErr: true},
+		{name: "MySQL fractional seconds", store: "mysql", window: "1500ms", wantErr: true},
+		{name: "Unknown store", store: "redis", window: "1m", wantErr: true},
+		{name: "Bad window", store: "memory", window: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.env.RATE_LIMIT_REQUESTS = "10"
+			app.env.RATE_LIMIT_STORE = tt.store
+			app.env.RATE_LIMIT_WINDOW = tt.window
+
+			err := app.configureRateLimiter(nil)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Error("got nil error; want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if app.rateLimiter == nil {
+				t.Error("rate limiter wasn't set up")
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantJSON bool
+	}{
+		{"Web route", "/", false},
+		{"API route", "/api/v1/snippets", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.rateLimiter = newRateLimiter(newMemoryRateLimitStore(), 1, time.Minute)
+			ts := newTestServer(t, app.routes())
+
+			if code, _, _ := ts.get(t, tt.urlPath); code != http.StatusOK {
+				t.Fatalf("first request: got status %d; want %d", code, http.StatusOK)
+			}
+
+			code, headers, body := ts.get(t, tt.urlPath)
+			if code != http.StatusTooManyRequests {
+				t.Fatalf("got status %d; want %d", code, http.StatusTooManyRequests)
+			}
+
+			retryAfter, err := strconv.Atoi(headers.Get("Retry-After"))
+			if err != nil || retryAfter < 1 || retryAfter > 60 {
+				t.Fatalf("got Retry-After %q; want 1 to 60 seconds", headers.Get("Retry-After"))
+			}
+
+			isJSON := headers.Get("Content-Type") == "application/json"
+			if isJSON != tt.wantJSON {
+				t.Fatalf("got Content-Type %q; want JSON %t", headers.Get("Content-Type"), tt.wantJSON)
+			}
+			if !tt.wantJSON {
+				return
+			}
+
+			var got apiError
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			want := apiError{Error: "rate limit exceeded", RetryAfter: retryAfter}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got body %+v; want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+// The settings a SIGHUP reload applies. Everything else (the port, the DSN
+// and so on) only takes effect on a restart.
+var reloadableSettings = map[string]bool{
+	"LOG_LEVEL":           true,
+	"SITE_NOTICE":         true,
+	"MAINTENANCE_MODE":    true,
+	"RATE_LIMIT_REQUESTS": true,
+}
+
+// Reload the configuration on every SIGHUP until ctx is done.
+func (app *application) watchReload(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			app.reloadConfig()
+		}
+	}
+}
+
+// Re-read .env and apply the reloadable settings. Values in the file win over
+// the process environment, since the file is what's been edited.
+func (app *application) reloadConfig() {
+	values, err := godotenv.Read()
+	if err != nil {
+		app.logger.Error("config reload failed", "error", err.Error())
+		return
+	}
+
+	env, err := readEnv(func(key string) string {
+		if v, ok := values[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	})
+	if err != nil {
+		app.logger.Error("config reload failed", "error", err.Error())
+		return
+	}
+
+	app.applyConfig(env)
+}
+
+// Apply the reloadable settings from env. An invalid value is logged and the
+// current one kept. Changes to other settings are logged as needing a
+// restart. app.env isn't replaced, it stays the configuration the process
+// started with.
+func (app *application) applyConfig(env *Env) {
+	started := reflect.ValueOf(app.env).Elem()
+	reloaded := reflect.ValueOf(env).Elem()
+
+	for _, field := range reflect.VisibleFields(started.Type()) {
+		if !reloadableSettings[field.Name] && started.FieldByIndex(field.Index).String() != reloaded.FieldByIndex(field.Index).String() {
+			app.logger.Warn("config reload: setting changed but needs a restart", "setting", field.Name)
+		}
+	}
+
+	level, err := parseLogLevel(env.LOG_LEVEL)
+	if err != nil {
+		app.logger.Error("config reload: " + err.Error())
+	} else {
+		app.logLevel.Set(level)
+	}
+
+	app.siteNotice.Store(env.SITE_NOTICE)
+
+	maintenance, err := strconv.ParseBool(env.MAINTENANCE_MODE)
+	if err != nil {
+		app.logger.Error("config reload: invalid MAINTENANCE_MODE", "value", env.MAINTENANCE_MODE)
+	} else {
+		app.maintenance.Store(maintenance)
+	}
+
+	limit, err := strconv.Atoi(env.RATE_LIMIT_REQUESTS)
+	switch {
+	case err != nil || limit < 0:
+		app.logger.Error("config reload: invalid RATE_LIMIT_REQUESTS", "value", env.RATE_LIMIT_REQUESTS)
+	case app.rateLimiter == nil:
+		if limit != 0 {
+			app.logger.Warn("config reload: rate limiting was disabled at startup and needs a restart to enable")
+		}
+	default:
+		app.rateLimiter.limit.Store(int64(limit))
+	}
+
+	app.logger.Info("config reloaded", "log_level", app.logLevel.Level().String(), "maintenance", app.maintenance.Load(), "site_notice", env.SITE_NOTICE != "")
+}
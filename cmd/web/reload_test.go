@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The settings without defaults, which readEnv needs to be given.
+var requiredTestEnv = map[string]string{
+	"PORT": "4000",
+	"HOST": "localhost",
+	"DSN":  "web:pass@/snippetbox",
+	"ENV":  "test",
+}
+
+// Create a test application whose starting configuration is the Env
+// defaults, logging to the returned buffer.
+func newReloadTestApplication(t *testing.T) (*application, *bytes.Buffer) {
+	t.Helper()
+
+	env, err := readEnv(func(key string) string { return requiredTestEnv[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.RATE_LIMIT_REQUESTS = "10"
+
+	var logs bytes.Buffer
+
+	app := newTestApplication(t)
+	app.env = env
+	app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	app.logLevel.Set(slog.LevelInfo)
+	app.rateLimiter = newRateLimiter(newMemoryRateLimitStore(), 10, time.Minute)
+
+	return app, &logs
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		change          func(env *Env)
+		wantLevel       slog.Level
+		wantNotice      string
+		wantMaintenance bool
+		wantLimit       int64
+		wantLog         string
+	}{
+		{
+			name:      "Unchanged",
+			change:    func(env *Env) {},
+			wantLevel: slog.LevelInfo,
+			wantLimit: 10,
+		},
+		{
+			name: "Reloadable settings",
+			change: func(env *Env) {
+				env.LOG_LEVEL, env.SITE_NOTICE, env.MAINTENANCE_MODE, env.RATE_LIMIT_REQUESTS = "debug", "Back soon", "true", "20"
+			},
+			wantLevel:       slog.LevelDebug,
+			wantNotice:      "Back soon",
+			wantMaintenance: true,
+			wantLimit:       20,
+		},
+		{
+			name:      "Invalid log level kept",
+			change:    func(env *Env) { env.LOG_LEVEL = "loud" },
+			wantLevel: slog.LevelInfo,
+			wantLimit: 10,
+			wantLog:   "level=ERROR",
+		},
+		{
+			name:      "Invalid rate limit kept",
+			change:    func(env *Env) { env.RATE_LIMIT_REQUESTS = "-1" },
+			wantLevel: slog.LevelInfo,
+			wantLimit: 10,
+			wantLog:   "invalid RATE_LIMIT_REQUESTS",
+		},
+		{
+			name:      "Restart needed",
+			change:    func(env *Env) { env.PORT, env.DSN = "9999", "other:pass@/snippetbox" },
+			wantLevel: slog.LevelInfo,
+			wantLimit: 10,
+			wantLog:   "setting changed but needs a restart\" setting=DSN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, logs := newReloadTestApplication(t)
+
+			env := *app.env
+			tt.change(&env)
+			app.applyConfig(&env)
+
+			if got := app.logLevel.Level(); got != tt.wantLevel {
+				t.Errorf("got log level %s; want %s", got, tt.wantLevel)
+			}
+			if got, _ := app.siteNotice.Load().(string); got != tt.wantNotice {
+				t.Errorf("got site notice %q; want %q", got, tt.wantNotice)
+			}
+			if got := app.maintenance.Load(); got != tt.wantMaintenance {
+				t.Errorf("got maintenance %t; want %t", got, tt.wantMaintenance)
+			}
+			if got := app.rateLimiter.limit.Load(); got != tt.wantLimit {
+				t.Errorf("got rate limit %d; want %d", got, tt.wantLimit)
+			}
+			if tt.wantLog != "" && !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("want logs to contain %q; got %q", tt.wantLog, logs.String())
+			}
+			if strings.Contains(logs.String(), "needs a restart\" setting=LOG_LEVEL") {
+				t.Error("want no restart note for a reloadable setting")
+			}
+		})
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	// Settings missing from .env come from the process environment.
+	for key, value := range requiredTestEnv {
+		t.Setenv(key, value)
+	}
+	t.Setenv("RATE_LIMIT_REQUESTS", "10")
+
+	// The templates are loaded from the working directory, so the app is
+	// created before moving to one with just a .env file.
+	app, logs := newReloadTestApplication(t)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Without a .env file nothing changes.
+	app.reloadConfig()
+	if got := app.logLevel.Level(); got != slog.LevelInfo {
+		t.Errorf("got log level %s; want %s", got, slog.LevelInfo)
+	}
+	if !strings.Contains(logs.String(), "config reload failed") {
+		t.Errorf("want the failed reload logged; got %q", logs.String())
+	}
+
+	err = os.WriteFile(filepath.Join(dir, ".env"), []byte("LOG_LEVEL=debug\nSITE_NOTICE=Back soon\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.reloadConfig()
+	if got := app.logLevel.Level(); got != slog.LevelDebug {
+		t.Errorf("got log level %s; want %s", got, slog.LevelDebug)
+	}
+	if got, _ := app.siteNotice.Load().(string); got != "Back soon" {
+		t.Errorf("got site notice %q; want %q", got, "Back soon")
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 )
 
+// The deadline for read-only routes, which should answer well within the
+// global request timeout.
+const readTimeout = 5 * time.Second
+
 func (app *application) routes() http.Handler {
 	// Initialize the router.
 	router := httprouter.New()
@@ -17,21 +23,108 @@ func (app *application) routes() http.Handler {
 	})
 
 	// Update the pattern for the route for the static files.
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
-	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
+	router.Handler(http.MethodGet, "/static/*filepath", app.staticHandler())
+	router.HandlerFunc(http.MethodGet, "/favicon.ico", app.favicon)
+	router.HandlerFunc(http.MethodGet, "/site.webmanifest", app.siteWebManifest)
+
+	// Liveness and readiness checks for load balancers and orchestrators.
+	router.HandlerFunc(http.MethodGet, "/healthz", app.healthz)
+	router.HandlerFunc(http.MethodGet, "/readyz", app.readyz)
+	router.HandlerFunc(http.MethodGet, "/version", app.versionHandler)
+
+	// Expose runtime metrics in development only, they aren't meant to be
+	// public.
+	if app.env.ENV == "dev" {
+		router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+	}
+
+	// The JSON API doesn't use sessions or CSRF tokens, so it sits outside the
+	// dynamic chain (and its origin check). Writes need an API token instead,
+	// which also lets admins through maintenance mode.
+	api := alice.New(app.maintenanceMode)
+	apiWrite := alice.New(app.authenticateToken).Extend(api)
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", alice.New(app.limitQuery).Extend(api).Then(withTimeout(readTimeout, app.apiSnippetList)))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiWrite.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.Then(withTimeout(readTimeout, app.apiSnippetGet)))
+	router.Handler(http.MethodPost, "/api/v1/snippets/exists", api.ThenFunc(app.apiSnippetsExist))
+	router.Handler(http.MethodPost, "/api/v1/snippets/validate", api.ThenFunc(app.apiSnippetValidate))
+
+	// The dynamic chain wraps every route which needs session data or renders
+	// forms: the origin check first, then session loading, then CSRF
+	// protection (which relies on the session cookie already being in place),
+	// then authentication. None of these responses should be cached.
+	// Maintenance mode comes last so that it knows whether the user is an
+	// admin.
+	dynamic := alice.New(noCache, app.verifyOrigin, app.sessionManager.LoadAndSave, app.noSurf, app.authenticate, app.maintenanceMode)
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave)
+	// Pages which read query parameters have their length checked first.
+	listing := alice.New(app.limitQuery).Extend(dynamic)
 
-	// And then create the routes using the appropriate methods, patterns and
-	// handlers.
-	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
-	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	// Routes are grouped by the chain they share. Further chains can be built
+	// from this one with dynamic.Append(...) for groups which need more.
+	router.Handler(http.MethodGet, "/", listing.Then(withTimeout(readTimeout, app.home)))
+	router.Handler(http.MethodGet, "/search", listing.Then(withTimeout(readTimeout, app.search)))
+	router.Handler(http.MethodGet, "/events", dynamic.ThenFunc(app.events))
+	router.Handler(http.MethodGet, "/snippet/view/:id", listing.Then(withTimeout(readTimeout, app.snippetView)))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.Then(withTimeout(readTimeout, app.snippetRaw)))
+	router.Handler(http.MethodGet, "/snippet/random", dynamic.Then(withTimeout(readTimeout, app.snippetRandom)))
+	router.Handler(http.MethodGet, "/share", dynamic.ThenFunc(app.share))
 	router.Handler(http.MethodGet, "/snippet/create", dynamic.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", dynamic.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/create", alice.New(app.limitSnippetBody).Extend(dynamic).ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/restore/:id", dynamic.ThenFunc(app.snippetRestorePost))
+	router.Handler(http.MethodPost, "/snippet/report/:id", dynamic.ThenFunc(app.snippetReportPost))
+	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
+	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
+	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodPost, "/user/logout", dynamic.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodPost, "/notice/dismiss", dynamic.ThenFunc(app.noticeDismissPost))
+
+	// Routes which need a logged in user.
+	protected := dynamic.Append(app.requireAuthentication)
+
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDeletePost))
+	router.Handler(http.MethodPost, "/snippet/archive/:id", protected.ThenFunc(app.snippetArchivePost))
+	router.Handler(http.MethodPost, "/snippet/unarchive/:id", protected.ThenFunc(app.snippetUnarchivePost))
+	router.Handler(http.MethodPost, "/snippet/extend/:id", protected.ThenFunc(app.snippetExtendPost))
+	router.Handler(http.MethodGet, "/snippet/diff/:id", alice.New(app.limitQuery).Extend(protected).ThenFunc(app.snippetDiff))
+	router.Handler(http.MethodPost, "/snippet/share/:id", protected.ThenFunc(app.snippetSharePost))
+	router.Handler(http.MethodPost, "/snippet/favorite/:id", protected.ThenFunc(app.snippetFavoritePost))
+	router.Handler(http.MethodGet, "/favorites", alice.New(app.limitQuery).Extend(protected).Then(withTimeout(readTimeout, app.favorites)))
+	router.Handler(http.MethodGet, "/user/tokens", protected.ThenFunc(app.userTokens))
+	router.Handler(http.MethodPost, "/user/tokens", protected.ThenFunc(app.userTokensPost))
+	router.Handler(http.MethodPost, "/user/tokens/revoke", protected.ThenFunc(app.userTokensRevokePost))
+
+	// Routes for admins only.
+	admin := protected.Append(app.requireAdmin)
+
+	// Profiling, when enabled, for admins only. These routes skip CSRF
+	// protection (they're all GETs) and maintenance mode.
+	if app.pprofEnabled {
+		profiling := alice.New(noCache, app.sessionManager.LoadAndSave, app.authenticate, app.requireAuthentication, app.requireAdmin)
+		router.Handler(http.MethodGet, "/debug/pprof/*item", profiling.ThenFunc(pprofHandler))
+	}
+
+	router.Handler(http.MethodGet, "/admin/audit", alice.New(app.limitQuery).Extend(admin).ThenFunc(app.adminAudit))
+	router.Handler(http.MethodGet, "/status", admin.ThenFunc(app.status))
+	router.Handler(http.MethodGet, "/admin/reports", admin.ThenFunc(app.adminReports))
+	router.Handler(http.MethodPost, "/admin/reports/dismiss/:id", admin.ThenFunc(app.adminReportDismissPost))
+	router.Handler(http.MethodPost, "/admin/reports/remove/:id", admin.ThenFunc(app.adminReportRemovePost))
+	router.Handler(http.MethodPost, "/admin/snippets/purge-expired", admin.ThenFunc(app.adminPurgeExpiredPost))
+	router.Handler(http.MethodGet, "/admin/tags", admin.ThenFunc(app.adminTags))
+	router.Handler(http.MethodPost, "/admin/tags/rename", admin.ThenFunc(app.adminTagRenamePost))
+	router.Handler(http.MethodPost, "/admin/tags/delete", admin.ThenFunc(app.adminTagDeletePost))
 
-	// Create the middleware chain as normal.
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	// The standard chain runs for every request, in order: recoverPanic ->
+	// countRequests -> logRequest -> canonicalHost -> rateLimit ->
+	// secureHeaders -> timeout -> router.
+	standard := alice.New(app.recoverPanic, countRequests, app.requestID, app.logRequest, app.canonicalHost, app.rateLimit, secureHeaders, app.timeout)
 
-	// Wrap the router with the middleware and return it as normal.
-	return standard.Then(router)
+	// Wrap the router with the middleware and return the composed handler.
+	// The base path is removed first, so that nothing else needs to know
+	// about it.
+	return app.withBasePath(standard.Then(router))
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// The HTML sanitization policies a deployment can choose between:
+//
+//   - strict:  strips every tag, leaving only text.
+//   - ugc:     bluemonday's policy for user generated content (links,
+//     formatting, lists, tables, images), with links marked nofollow.
+//   - relaxed: ugc, plus class attributes (e.g. for code highlighting) and
+//     links opened in a new tab.
+func newSanitizePolicy(name string) (*bluemonday.Policy, error) {
+	switch strings.ToLower(name) {
+	case "strict":
+		return bluemonday.StrictPolicy(), nil
+	case "ugc":
+		return bluemonday.UGCPolicy(), nil
+	case "relaxed":
+		p := bluemonday.UGCPolicy()
+		p.AllowAttrs("class").Globally()
+		p.AddTargetBlankToFullyQualifiedLinks(true)
+		return p, nil
+	default:
+		return nil, fmt.Errorf("invalid sanitize policy %q", name)
+	}
+}
+
+// The policy used by the sanitize template function. It's set from
+// SANITIZE_POLICY at startup, before the templates are parsed.
+var sanitizePolicy = bluemonday.UGCPolicy()
+
+// Clean untrusted HTML (such as rendered Markdown or highlighted code) with
+// the configured policy, so it can be output without escaping.
+func sanitize(html string) template.HTML {
+	return template.HTML(sanitizePolicy.Sanitize(html))
+}
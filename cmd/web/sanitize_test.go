@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSanitizePolicy(t *testing.T) {
+	const input = `<p>See <a href="https://example.com">the docs</a><script>alert(1)</script> <a href="javascript:alert(1)">here</a></p>`
+
+	tests := []struct {
+		name        string
+		policy      string
+		wantLink    bool
+		wantContain []string
+	}{
+		{
+			name:        "Strict",
+			policy:      "strict",
+			wantContain: []string{"See the docs"},
+		},
+		{
+			name:        "UGC",
+			policy:      "ugc",
+			wantLink:    true,
+			wantContain: []string{`rel="nofollow"`},
+		},
+		{
+			name:        "Relaxed",
+			policy:      "relaxed",
+			wantLink:    true,
+			wantContain: []string{`target="_blank"`},
+		},
+		{
+			name:        "Case insensitive",
+			policy:      "STRICT",
+			wantContain: []string{"See the docs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newSanitizePolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := p.Sanitize(input)
+
+			if strings.Contains(got, `href="https://example.com"`) != tt.wantLink {
+				t.Errorf("got %q; want link kept %t", got, tt.wantLink)
+			}
+			for _, want := range tt.wantContain {
+				if !strings.Contains(got, want) {
+					t.Errorf("got %q; want it to contain %q", got, want)
+				}
+			}
+
+			// Every policy drops scripts and unsafe links.
+			if strings.Contains(got, "<script") || strings.Contains(got, "javascript:") {
+				t.Errorf("got %q; want scripts and javascript: links removed", got)
+			}
+		})
+	}
+
+	_, err := newSanitizePolicy("lenient")
+	if err == nil {
+		t.Error("got nil error for an unknown policy; want an error")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexedwards/scs/mysqlstore"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// How long in-flight requests get to finish once shutdown has started.
+const shutdownTimeout = 30 * time.Second
+
+// Serve the application on addr until it receives SIGINT or SIGTERM, then
+// shut down gracefully: stop accepting connections, end event streams, wait
+// for in-flight requests and stop the background goroutines (the database
+// monitor and the rate limit and session cleanups). SIGHUP reloads the
+// configuration in the meantime.
+func (app *application) serve(addr string) error {
+	srv := &http.Server{
+		Addr:     addr,
+		Handler:  app.routes(),
+		ErrorLog: slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	// Long-lived event streams would otherwise hold shutdown up until the
+	// timeout.
+	srv.RegisterOnShutdown(func() {
+		close(app.shutdown)
+	})
+
+	app.configureHTTP2(srv)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if app.dbMonitor != nil {
+		go app.dbMonitor.run(ctx)
+	}
+
+	go app.watchReload(ctx)
+
+	logCleanupError := func(err error) {
+		app.logger.Error(err.Error())
+	}
+	if app.rateLimiter != nil {
+		go app.rateLimiter.cleanup(ctx, logCleanupError)
+	}
+	if app.reportLimiter != nil {
+		go app.reportLimiter.cleanup(ctx, logCleanupError)
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		app.logger.Info("shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(shutdownCtx)
+
+		// The MySQL session store runs its own cleanup goroutine.
+		if store, ok := app.sessionManager.Store.(*mysqlstore.MySQLStore); ok {
+			store.StopCleanup()
+		}
+
+		shutdownErr <- err
+	}()
+
+	var err error
+	if app.tlsEnabled() {
+		err = srv.ListenAndServeTLS(app.env.TLS_CERT_FILE, app.env.TLS_KEY_FILE)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped")
+	return nil
+}
+
+// Apply the HTTP2 setting to srv. The standard library negotiates h2 over TLS
+// by default, so "off" has to switch that off explicitly with an empty
+// TLSNextProto. "h2c" wraps the handler to accept cleartext HTTP/2 (prior
+// knowledge or an Upgrade), and h2 over TLS stays available alongside it.
+func (app *application) configureHTTP2(srv *http.Server) {
+	switch app.env.HTTP2 {
+	case "on":
+	case "h2c":
+		srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{})
+	default:
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+}
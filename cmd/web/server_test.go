@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// Start srv on a local port, over TLS when tlsConfig isn't nil, and return
+// its address.
+func startHTTP2TestServer(t *testing.T, srv *http.Server, tlsConfig *tls.Config) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+		go srv.ServeTLS(ln, "", "")
+	} else {
+		go srv.Serve(ln)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	return ln.Addr().String()
+}
+
+func TestConfigureHTTP2(t *testing.T) {
+	// Borrow the test server's certificate rather than generating one.
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	cert := certServer.TLS.Certificates[0]
+	certServer.Close()
+
+	echoProto := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		tests := []struct {
+			setting   string
+			wantProto string
+			wantALPN  string
+		}{
+			{"off", "HTTP/1.1", "http/1.1"},
+			{"on", "HTTP/2.0", "h2"},
+			{"h2c", "HTTP/2.0", "h2"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.setting, func(t *testing.T) {
+				app := newTestApplication(t)
+				app.env.HTTP2 = tt.setting
+
+				srv := &http.Server{Handler: echoProto}
+				app.configureHTTP2(srv)
+				addr := startHTTP2TestServer(t, srv, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+				client := &http.Client{Transport: &http.Transport{
+					TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+					ForceAttemptHTTP2: true,
+				}}
+
+				rs, err := client.Get("https://" + addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rs.Body.Close()
+
+				if rs.Proto != tt.wantProto {
+					t.Errorf("got protocol %s; want %s", rs.Proto, tt.wantProto)
+				}
+				if got := rs.TLS.NegotiatedProtocol; got != tt.wantALPN {
+					t.Errorf("got negotiated protocol %q; want %q", got, tt.wantALPN)
+				}
+			})
+		}
+	})
+
+	t.Run("Cleartext", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.env.HTTP2 = "h2c"
+
+		srv := &http.Server{Handler: echoProto}
+		app.configureHTTP2(srv)
+		addr := startHTTP2TestServer(t, srv, nil)
+
+		// A client speaking HTTP/2 with prior knowledge, as a proxy would.
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}}
+
+		rs, err := client.Get("http://" + addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+
+		if rs.Proto != "HTTP/2.0" {
+			t.Errorf("got protocol %s; want HTTP/2.0", rs.Proto)
+		}
+	})
+}
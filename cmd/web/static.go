@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The directory static files are served from.
+const staticDir = "./ui/static/"
+
+// Serve files from ./ui/static/ under /static/. Content types come from the
+// file extension only, never from sniffing the contents, and anything
+// without a known extension is sent as application/octet-stream. Dotfiles
+// and directory listings are not served. Versioned URLs (see static) can
+// be cached for good, since a change to the file changes the URL.
+func (app *application) staticHandler() http.Handler {
+	fileServer := http.StripPrefix("/static", http.FileServer(http.Dir(staticDir)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			app.notFound(w)
+			return
+		}
+
+		for _, segment := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(segment, ".") {
+				app.notFound(w)
+				return
+			}
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(r.URL.Path))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if r.URL.Query().Has("v") {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// A static file's content hash, along with the modification time it was
+// computed for.
+type staticVersion struct {
+	modTime time.Time
+	hash    string
+}
+
+var staticVersions sync.Map // file path -> staticVersion
+
+// The static template function returns the URL of a file under ./ui/static/
+// with a ?v= query holding a hash of its contents, e.g. static "css/main.css"
+// gives "/static/css/main.css?v=1a2b3c4d5e6f". Browsers then fetch the file
+// again whenever it changes. Hashes are cached until the file's modification
+// time changes. A file which can't be read gets the plain URL. The base path
+// isn't included, templates prefix it themselves.
+func static(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	url := "/static/" + name
+
+	file := filepath.Join(staticDir, filepath.FromSlash(name))
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return url
+	}
+
+	if v, ok := staticVersions.Load(file); ok && v.(staticVersion).modTime.Equal(info.ModTime()) {
+		return url + "?v=" + v.(staticVersion).hash
+	}
+
+	hash, err := hashFile(file)
+	if err != nil {
+		return url
+	}
+	staticVersions.Store(file, staticVersion{modTime: info.ModTime(), hash: hash})
+
+	return url + "?v=" + hash
+}
+
+// Return the first 12 hex characters of the SHA-256 of a file's contents.
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Change to a scratch directory holding just the given files under
+// ui/static, so tests can add files with odd names or change them. The
+// working directory is restored when the test ends.
+func chdirStaticFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, "ui", "static", name)
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestStaticHandler(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.staticHandler()
+
+	chdirStaticFiles(t, map[string]string{
+		"css/main.css":    "body {}",
+		"files/data.xyz1": "<html><script>alert(1)</script></html>",
+		".env":            "SECRET=1",
+		".git/config":     "[core]",
+	})
+
+	tests := []struct {
+		name             string
+		urlPath          string
+		wantCode         int
+		wantContentType  string
+		wantCacheControl string
+	}{
+		{"CSS", "/static/css/main.css", http.StatusOK, "text/css; charset=utf-8", ""},
+		{"Versioned CSS", "/static/css/main.css?v=abc", http.StatusOK, "text/css; charset=utf-8", "public, max-age=31536000, immutable"},
+		{"Unknown extension", "/static/files/data.xyz1", http.StatusOK, "application/octet-stream", ""},
+		{"Dotfile", "/static/.env", http.StatusNotFound, "", ""},
+		{"Dot directory", "/static/.git/config", http.StatusNotFound, "", ""},
+		{"Directory listing", "/static/css/", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.urlPath, nil))
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.wantContentType)
+			}
+			if got := rr.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("got X-Content-Type-Options %q; want %q", got, "nosniff")
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("got Cache-Control %q; want %q", got, tt.wantCacheControl)
+			}
+		})
+	}
+}
+
+func TestStatic(t *testing.T) {
+	chdirStaticFiles(t, map[string]string{"css/app.css": "body {}"})
+
+	hash := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])[:12]
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"File", "css/app.css", "/static/css/app.css?v=" + hash("body {}")},
+		{"Leading slash", "/css/app.css", "/static/css/app.css?v=" + hash("body {}")},
+		{"Outside the directory", "../../css/app.css", "/static/css/app.css?v=" + hash("body {}")},
+		{"Missing file", "css/missing.css", "/static/css/missing.css"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := static(tt.path); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A change to the file gives a new version.
+	file := filepath.Join("ui", "static", "css", "app.css")
+	err := os.WriteFile(file, []byte("body { margin: 0 }"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(file, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := static("css/app.css"), "/static/css/app.css?v="+hash("body { margin: 0 }"); got != want {
+		t.Errorf("after a change got %q; want %q", got, want)
+	}
+}
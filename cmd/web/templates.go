@@ -1,9 +1,14 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/joshuagageellis/snippetbox.git/internal/models"
 )
@@ -13,59 +18,281 @@ import (
 // At the moment it only contains one field, but we'll add more
 // to it as the build progresses.
 type templateData struct {
-	CurrentYear int
-	Snippet     models.Snippet
-	Snippets    []models.Snippet
-	Form        any
-	Flash       string
+	CurrentYear     int
+	Snippet         models.Snippet
+	Snippets        []models.Snippet
+	Form            any
+	Flash           string
+	CSRFToken       string
+	IsAuthenticated bool
+	IsAdmin         bool
+	// Prefix for every link within the site, empty when served from the
+	// root.
+	BasePath string
+	// Snippets expiring within this window are flagged in listings.
+	ExpiresSoonWithin time.Duration
+	// Id of a just-deleted snippet which can still be restored.
+	UndoDeleteID int
+	// Whether the current user may manage the snippet being shown.
+	CanManage bool
+	// Whether share links can be created.
+	CanShare bool
+	// Whether the current user has favorited the snippet being shown.
+	IsFavorite bool
+	// Whether the snippet's content is shown with line numbers.
+	LineNumbers bool
+	// Tags of the snippet being shown.
+	Tags []string
+	// The numbers of days a snippet may be kept for.
+	Expiries []int
+	// Current sort order of a listing, and the tag it's limited to, if any.
+	Sort string
+	Tag  string
+	// The search query, and how many snippets match it in total.
+	Search      string
+	SearchTotal int
+	// Locale to format dates in, negotiated from Accept-Language.
+	Locale string
+	// Sitewide announcement, empty if there's none or it was dismissed.
+	SiteNotice string
+	// A snippet's versions, and the unified diff between two of them.
+	Versions []models.SnippetVersion
+	Diff     string
+	DiffFrom int
+	DiffTo   int
+	// Entries shown on the admin audit log page.
+	AuditEntries []models.AuditEntry
+	// Open reports shown on the admin moderation page.
+	Reports []models.Report
+	// Neighbouring page numbers of a paginated listing, 0 when there's none.
+	PrevPage int
+	NextPage int
 }
 
 // Create a humanDate function which returns a nicely formatted string
-// representation of a time.Time object.
-func humanDate(t time.Time) string {
-	return t.Format("02 Jan 2006 at 15:04")
+// representation of a time.Time object in the given locale.
+func humanDate(t time.Time, locale string) string {
+	return formatDate(t.In(displayLocation), locale)
+}
+
+// The time zone dates are shown in. Times are always stored in UTC; this is
+// only applied when formatting them. It's set from DISPLAY_TZ at startup.
+var displayLocation = time.UTC
+
+// Report whether t falls within the given window from now. Both sides are
+// compared in UTC, matching how expiry times are stored. Times already in the
+// past don't count as expiring soon.
+func expiresSoon(t time.Time, within time.Duration) bool {
+	remaining := t.UTC().Sub(time.Now().UTC())
+	return remaining > 0 && remaining <= within
+}
+
+// Shorten s to at most n runes, followed by an ellipsis if anything was cut.
+// Where possible the cut is made at the last space so words aren't split.
+// Working in runes means a multi-byte character is never split. A negative n
+// is treated as 0.
+func truncate(s string, n int) string {
+	n = max(n, 0)
+
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	cut := string(runes[:n])
+
+	// Back off to the last space, unless the cut already falls between words.
+	if !unicode.IsSpace(runes[n]) {
+		if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+			cut = cut[:i]
+		}
+	}
+
+	return strings.TrimRightFunc(cut, unicode.IsSpace) + "…"
+}
+
+// Describe an expiry in days, in years or weeks where it divides evenly,
+// e.g. "1 year", "2 weeks" or "30 days".
+func expiryLabel(days int) string {
+	n, unit := days, "day"
+	switch {
+	case days%365 == 0:
+		n, unit = days/365, "year"
+	case days%7 == 0:
+		n, unit = days/7, "week"
+	}
+
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// Render content as a table with one numbered row per line, for showing code.
+// Each line is escaped. Like Snippet.Lines, a trailing newline doesn't start
+// an extra empty line, and empty content gives no table at all.
+func numberLines(content string) template.HTML {
+	if content == "" {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString("<table class='lines'>")
+	for i, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		fmt.Fprintf(&b, "<tr><td class='number'>%d</td><td><pre><code>%s</code></pre></td></tr>", i+1, template.HTMLEscapeString(line))
+	}
+	b.WriteString("</table>")
+
+	return template.HTML(b.String())
+}
+
+// Return an excerpt of content around the first case-insensitive match of
+// query, with every match in it wrapped in <mark>. About window runes of
+// context are kept on either side of the match, with an ellipsis where
+// content was cut. With no match (or no query) the excerpt is taken from the
+// start instead. Everything but the <mark> tags is escaped, and working in
+// runes means a multi-byte character is never split.
+func excerptHighlight(content, query string, window int) template.HTML {
+	text := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	needle := []rune(strings.ToLower(query))
+
+	// Lowercasing can change the length of some strings, in which case
+	// positions in lower wouldn't line up with text. Fall back to the plain
+	// excerpt then.
+	if len(lower) != len(text) {
+		needle = nil
+	}
+
+	start := indexRunes(lower, needle, 0)
+	if start == -1 {
+		return template.HTML(template.HTMLEscapeString(truncate(content, 2*window)))
+	}
+
+	from := max(0, start-window)
+	to := min(len(text), start+len(needle)+window)
+
+	var b strings.Builder
+
+	if from > 0 {
+		b.WriteString("…")
+	}
+	for i := from; i < to; {
+		match := indexRunes(lower[:to], needle, i)
+		if match == -1 {
+			b.WriteString(template.HTMLEscapeString(string(text[i:to])))
+			break
+		}
+		b.WriteString(template.HTMLEscapeString(string(text[i:match])))
+		b.WriteString("<mark>" + template.HTMLEscapeString(string(text[match:match+len(needle)])) + "</mark>")
+		i = match + len(needle)
+	}
+	if to < len(text) {
+		b.WriteString("…")
+	}
+
+	return template.HTML(b.String())
+}
+
+// Return the index of the first occurrence of needle in haystack at or
+// after from, or -1 if there isn't one or needle is empty.
+func indexRunes(haystack, needle []rune, from int) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		if slices.Equal(haystack[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
 }
 
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":        humanDate,
+	"expiresSoon":      expiresSoon,
+	"truncate":         truncate,
+	"sanitize":         sanitize,
+	"static":           static,
+	"numberLines":      numberLines,
+	"expiryLabel":      expiryLabel,
+	"excerptHighlight": excerptHighlight,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
+	// Parse the base template file and every partial once. This layout set
+	// is cloned for each page below, rather than re-reading the shared files
+	// from disk for every page.
+	layout, err := template.New("base").Funcs(functions).ParseFiles("./ui/html/base.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err = layout.ParseGlob("./ui/html/partials/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
 	pages, err := filepath.Glob("./ui/html/pages/*.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
+	// No pages means the app was most likely started from the wrong
+	// directory. Every page would fail to render, so treat it as an error
+	// rather than returning an empty cache.
+	if len(pages) == 0 {
+		return nil, errors.New("no page templates found in ./ui/html/pages")
+	}
+
 	for _, page := range pages {
 		name := filepath.Base(page)
 
-		// Parse the base template file into a template set.
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.tmpl")
-		if err != nil {
-			return nil, err
-		}
-
-		// Call ParseGlob() *on this template set* to add any partials.
-		ts, err = ts.ParseGlob("./ui/html/partials/*.tmpl")
+		// Each page gets its own copy of the layout, so the blocks it
+		// defines (or overrides) don't leak into other pages.
+		ts, err := layout.Clone()
 		if err != nil {
 			return nil, err
 		}
 
-		// Call ParseFiles() *on this template set* to add the  page template.
+		// Call ParseFiles() *on this template set* to add the page template.
 		ts, err = ts.ParseFiles(page)
 		if err != nil {
 			return nil, err
 		}
 
-		// Add the template set to the map as normal...
+		// Add the template set to the map, keyed by the page filename.
 		cache[name] = ts
 	}
 
 	// Return the map.
 	return cache, nil
 }
+
+// Look up the template set for a page. With template reloading switched on
+// (for development) the templates are parsed from disk on every call, so
+// edits show up without a restart; otherwise the startup cache is used.
+func (app *application) template(page string) (*template.Template, error) {
+	cache := app.templateCache
+
+	if app.templateReload {
+		var err error
+		cache, err = newTemplateCache()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ts, ok := cache[page]
+	if !ok {
+		return nil, fmt.Errorf("the template %s does not exist (%d pages loaded)", page, len(cache))
+	}
+
+	return ts, nil
+}
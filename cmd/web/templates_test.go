@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTemplateCache(t *testing.T) {
+	cache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := filepath.Glob("./ui/html/pages/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache) != len(pages) {
+		t.Errorf("got %d cache entries; want one for each of the %d pages", len(cache), len(pages))
+	}
+	for _, page := range pages {
+		if _, ok := cache[filepath.Base(page)]; !ok {
+			t.Errorf("no cache entry for %s", filepath.Base(page))
+		}
+	}
+
+	// Each page's blocks stay with that page.
+	for name, want := range map[string]string{"home.tmpl": "Home", "login.tmpl": "Login"} {
+		var buf bytes.Buffer
+		err = cache[name].ExecuteTemplate(&buf, "title", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s: got title %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestExpiresSoon(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires time.Time
+		want    bool
+	}{
+		{"In 1 hour", time.Now().Add(time.Hour), true},
+		{"In 1 hour, other time zone", time.Now().Add(time.Hour).In(time.FixedZone("UTC+10", 10*60*60)), true},
+		{"In 10 days", time.Now().Add(10 * 24 * time.Hour), false},
+		{"Already expired", time.Now().Add(-time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiresSoon(tt.expires, 24*time.Hour); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"Short", "hello", 10, "hello"},
+		{"Exact length", "hello world", 11, "hello world"},
+		{"Cut mid-word", "hello world foo", 13, "hello world…"},
+		{"Cut at a space", "hello world foo", 11, "hello world…"},
+		{"Cut before several spaces", "hello  world", 5, "hello…"},
+		{"No space to back off to", "helloworld", 5, "hello…"},
+		{"Multi-byte", "古池や蛙飛び込む水の音", 5, "古池や蛙飛…"},
+		{"Multi-byte words", "héllo wörld", 8, "héllo…"},
+		{"Empty", "", 5, ""},
+		{"Zero", "hello", 0, "…"},
+		{"Negative", "hello", -1, "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.s, tt.n); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcerptHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		query   string
+		window  int
+		want    string
+	}{
+		{"Match at start", "Frog jumps into the pond", "frog", 5, "<mark>Frog</mark> jump…"},
+		{"Match in middle", "An old silent pond, a frog jumps in", "FROG", 5, "…d, a <mark>frog</mark> jump…"},
+		{"Several matches", "frog, frog", "frog", 10, "<mark>frog</mark>, <mark>frog</mark>"},
+		{"No match", "An old silent pond", "toad", 6, "An old…"},
+		{"No query", "An old silent pond", "", 6, "An old…"},
+		{"Escaped", "<b>frog</b>", "frog", 3, "&lt;b&gt;<mark>frog</mark>&lt;/b…"},
+		{"Query escaped", "a <b> tag", "<b>", 10, "a <mark>&lt;b&gt;</mark> tag"},
+		{"Multi-byte", "古池や蛙飛び込む水の音", "蛙", 2, "…池や<mark>蛙</mark>飛び…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(excerptHighlight(tt.content, tt.query, tt.window)); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Copy the templates into a temporary directory and work from there, so the
+// test can edit them.
+func chdirTemplateCopy(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	err = filepath.WalkDir("ui/html", func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(dir, path)
+		err = os.MkdirAll(filepath.Dir(dst), 0o755)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNumberLines(t *testing.T) {
+	row := func(n int, line string) string {
+		return fmt.Sprintf("<tr><td class='number'>%d</td><td><pre><code>%s</code></pre></td></tr>", n, line)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Empty", "", ""},
+		{"One line", "hello", "<table class='lines'>" + row(1, "hello") + "</table>"},
+		{"Two lines", "a\nb", "<table class='lines'>" + row(1, "a") + row(2, "b") + "</table>"},
+		{"Trailing newline", "a\nb\n", "<table class='lines'>" + row(1, "a") + row(2, "b") + "</table>"},
+		{"Blank line kept", "a\n\nb", "<table class='lines'>" + row(1, "a") + row(2, "") + row(3, "b") + "</table>"},
+		{"Escaped", "<script>&\"'", "<table class='lines'>" + row(1, "&lt;script&gt;&amp;&#34;&#39;") + "</table>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(numberLines(tt.content)); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateReload(t *testing.T) {
+	chdirTemplateCopy(t)
+
+	cache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := os.ReadFile("ui/html/pages/home.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(original), `{{define "title"}}Home{{end}}`, `{{define "title"}}Edited{{end}}`, 1)
+	if edited == string(original) {
+		t.Fatal("home.tmpl has no title block to edit")
+	}
+	err = os.WriteFile("ui/html/pages/home.tmpl", []byte(edited), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		reload bool
+		want   string
+	}{
+		{name: "Cached", reload: false, want: "Home"},
+		{name: "Reload", reload: true, want: "Edited"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{templateCache: cache, templateReload: tt.reload}
+
+			ts, err := app.template("home.tmpl")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			err = ts.ExecuteTemplate(&buf, "title", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got title %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTemplateCacheNoPages(t *testing.T) {
+	chdirTemplateCopy(t)
+
+	err := os.RemoveAll("ui/html/pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := newTemplateCache()
+	if err == nil {
+		t.Errorf("got %d cache entries and nil error; want an error", len(cache))
+	}
+}
+
+func TestHumanDate(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		location *time.Location
+		tm       time.Time
+		want     string
+	}{
+		{
+			name:     "UTC",
+			location: time.UTC,
+			tm:       time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC),
+			want:     "17 Mar 2024 at 10:15",
+		},
+		{
+			name:     "New York",
+			location: newYork,
+			tm:       time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC),
+			want:     "17 Mar 2024 at 06:15",
+		},
+		{
+			name:     "New York, previous day",
+			location: newYork,
+			tm:       time.Date(2024, 1, 1, 2, 30, 0, 0, time.UTC),
+			want:     "31 Dec 2023 at 21:30",
+		},
+	}
+
+	t.Cleanup(func() { displayLocation = time.UTC })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			displayLocation = tt.location
+
+			if got := humanDate(tt.tm, "en"); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
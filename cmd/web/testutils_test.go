@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/joshuagageellis/snippetbox.git/internal/models/mocks"
+)
+
+// Templates and static files are read relative to the working directory, so
+// run the tests from the repository root, as the server is.
+func TestMain(m *testing.M) {
+	err := os.Chdir("../..")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Create an application for tests, with mocked models, an in-memory session
+// store and logs discarded. Settings are the defaults from Env, and can be
+// changed on the returned value before calling routes().
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formDecoder := form.NewDecoder()
+	formDecoder.SetMaxArraySize(maxFormArraySize)
+
+	// The test server uses TLS, so the session cookie can stay Secure.
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	return &application{
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		logLevel:        new(slog.LevelVar),
+		started:         time.Now(),
+		snippets:        &mocks.SnippetModel{},
+		users:           &mocks.UserModel{},
+		audit:           &mocks.AuditModel{},
+		reports:         &mocks.ReportModel{},
+		shutdown:        make(chan struct{}),
+		broadcaster:     newBroadcaster(),
+		env:             &Env{},
+		templateCache:   templateCache,
+		formDecoder:     formDecoder,
+		sessionManager:  sessionManager,
+		logAccessFormat: "slog",
+		accessLog:       io.Discard,
+		maxListLimit:    100,
+		maxQueryLength:  2048,
+		maxQueryParam:   256,
+		maxContentBytes: 65535,
+		defaultExpiry:   365,
+		loginLockout:    newLoginLockout(5, 15*time.Minute),
+		reportLimiter:   newRateLimiter(newMemoryRateLimitStore(), 10, time.Hour),
+	}
+}
+
+// Define a custom testServer type which embeds a httptest.Server instance.
+type testServer struct {
+	*httptest.Server
+}
+
+// Start a TLS test server for h. Its client keeps cookies between requests
+// and doesn't follow redirects, so tests can check them.
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// Make a GET request to the test server, returning the status code, headers
+// and body.
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ts.do(t, req)
+}
+
+// Make a POST request to the test server with the given form data.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, rs)
+}
+
+// Send a request built by the test, e.g. one with extra headers.
+func (ts *testServer) do(t *testing.T, req *http.Request) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, rs)
+}
+
+func readResponse(t *testing.T, rs *http.Response) (int, http.Header, string) {
+	t.Helper()
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+?)'>`)
+
+// Pull the CSRF token out of a rendered form.
+func extractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(matches[1])
+}
+
+// Log in as the mock user through the login form, so the test server's
+// client carries an authenticated session.
+func (ts *testServer) login(t *testing.T) {
+	t.Helper()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word1")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("logging in: got status %d; want %d", code, http.StatusSeeOther)
+	}
+}
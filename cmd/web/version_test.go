@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	defer func(v, c, b string) { version, commit, buildTime = v, c, b }(version, commit, buildTime)
+	version, commit, buildTime = "1.2.0", "abc123", "2024-01-02T03:04:05Z"
+
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	code, headers, body := ts.get(t, "/version")
+
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if got := headers.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/json")
+	}
+
+	var fields map[string]string
+	err := json.Unmarshal([]byte(body), &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"version": "1.2.0", "commit": "abc123", "build_time": "2024-01-02T03:04:05Z"}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("got %s %q; want %q", key, fields[key], value)
+		}
+	}
+	if len(fields) != len(want) {
+		t.Errorf("got %d fields; want %d", len(fields), len(want))
+	}
+}
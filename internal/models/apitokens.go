@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// Hash a plaintext API token for storage and lookup. Tokens are long and
+// random, so a plain SHA-256 is enough, unlike passwords.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIToken creates an API token for a user and returns it in plaintext.
+// Only its hash is stored, so this is the one chance to see it.
+func (m *UserModel) NewAPIToken(userID int) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	stmt := `INSERT INTO api_tokens (user_id, token_hash, created) VALUES(?, ?, UTC_TIMESTAMP())`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, stmt, userID, hashAPIToken(token))
+	if err != nil {
+		return "", classifyError(err)
+	}
+
+	return token, nil
+}
+
+// AuthenticateToken returns the user an API token belongs to.
+// ErrInvalidToken is returned if the token is unknown or has been revoked.
+func (m *UserModel) AuthenticateToken(token string) (User, error) {
+	var u User
+
+	stmt := `SELECT u.id, u.name, u.email, u.created, u.is_admin, u.workspace_id
+	FROM api_tokens t INNER JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = ? AND t.revoked_at IS NULL`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, hashAPIToken(token)).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.IsAdmin, &u.WorkspaceID)
+	if err != nil {
+		err = classifyError(err)
+		if errors.Is(err, ErrNoRecord) {
+			return User{}, ErrInvalidToken
+		}
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+// RevokeAPITokens revokes every API token a user has.
+func (m *UserModel) RevokeAPITokens(userID int) error {
+	stmt := `UPDATE api_tokens SET revoked_at = UTC_TIMESTAMP() WHERE user_id = ? AND revoked_at IS NULL`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+	return classifyError(err)
+}
+
+// Create the api_tokens table if it does not exist.
+func (m *UserModel) CreateAPITokenTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+			user_id INTEGER NOT NULL,
+			token_hash CHAR(64) NOT NULL,
+			created DATETIME NOT NULL,
+			revoked_at DATETIME NULL,
+			CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash),
+			INDEX idx_api_tokens_user (user_id)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
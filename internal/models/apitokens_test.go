@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	m := &UserModel{DB: newTestDB(t)}
+
+	userID, err := m.Insert("Alice", "alice@example.com", "pa$$word1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := m.NewAPIToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.NewAPIToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{first, second} {
+		user, err := m.AuthenticateToken(token)
+		if err != nil {
+			t.Fatalf("authenticating a new token: %v", err)
+		}
+		if user.ID != userID {
+			t.Errorf("got user %d; want %d", user.ID, userID)
+		}
+	}
+
+	_, err = m.AuthenticateToken("not-a-token")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token: got error %v; want %v", err, ErrInvalidToken)
+	}
+
+	// Revoking takes every token the user has, not just the latest.
+	err = m.RevokeAPITokens(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{first, second} {
+		_, err := m.AuthenticateToken(token)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("revoked token: got error %v; want %v", err, ErrInvalidToken)
+		}
+	}
+
+	// A token made after revoking works.
+	third, err := m.NewAPIToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.AuthenticateToken(third)
+	if err != nil {
+		t.Errorf("token made after revoking: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// The actions recorded in the audit log.
+const (
+	AuditCreate    = "create"
+	AuditUpdate    = "update"
+	AuditDelete    = "delete"
+	AuditRestore   = "restore"
+	AuditArchive   = "archive"
+	AuditUnarchive = "unarchive"
+	AuditExtend    = "extend"
+)
+
+// Define an AuditEntry type, one row of the audit_log table. UserID is 0 for
+// anonymous changes.
+type AuditEntry struct {
+	ID          int
+	WorkspaceID int
+	UserID      int
+	SnippetID   int
+	Action      string
+	Detail      string
+	IP          string
+	Created     time.Time
+}
+
+// AuditModelInterface describes the audit log methods the web handlers use,
+// so they can be given a mock instead of a database-backed AuditModel.
+type AuditModelInterface interface {
+	LogAction(e AuditEntry) error
+	Page(workspaceID, limit, offset int) ([]AuditEntry, error)
+}
+
+// Define an AuditModel type which wraps a database connection pool.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// LogAction records a change to a snippet. The entry's ID and Created are set
+// by the database.
+func (m *AuditModel) LogAction(e AuditEntry) error {
+	stmt := `INSERT INTO audit_log (workspace_id, user_id, snippet_id, action, detail, ip, created)
+	VALUES(?, NULLIF(?, 0), ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, e.WorkspaceID, e.UserID, e.SnippetID, e.Action, e.Detail, e.IP)
+	return classifyError(err)
+}
+
+// Page returns a page of a workspace's audit log, newest first.
+func (m *AuditModel) Page(workspaceID, limit, offset int) ([]AuditEntry, error) {
+	stmt := `SELECT id, workspace_id, COALESCE(user_id, 0), snippet_id, action, detail, ip, created FROM audit_log
+	WHERE workspace_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, workspaceID, limit, offset)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var entries []AuditEntry
+
+	for rows.Next() {
+		var e AuditEntry
+		err = rows.Scan(&e.ID, &e.WorkspaceID, &e.UserID, &e.SnippetID, &e.Action, &e.Detail, &e.IP, &e.Created)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return entries, nil
+}
+
+// Create the audit_log table if it does not exist.
+func (m *AuditModel) CreateAuditTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+			workspace_id INTEGER NOT NULL,
+			user_id INTEGER NULL,
+			snippet_id INTEGER NOT NULL,
+			action VARCHAR(20) NOT NULL,
+			detail VARCHAR(255) NOT NULL,
+			ip VARCHAR(45) NOT NULL,
+			created DATETIME NOT NULL,
+			INDEX idx_audit_log_workspace (workspace_id, id)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Dev seed database.
+func (m *AuditModel) SeedDatabase() error {
+	exists, err := tableExists(m.DB, "audit_log")
+	if err != nil || exists {
+		return err
+	}
+
+	return m.CreateAuditTable()
+}
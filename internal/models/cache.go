@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// CachedSnippetModel puts an LRU cache in front of Get. Every other method
+// goes straight to the wrapped model, and the ones which change a snippet
+// evict it from the cache. The cache is per process, so with several
+// instances a change made through one can take up to the TTL to show on the
+// others.
+type CachedSnippetModel struct {
+	SnippetModelInterface
+	cache       *expirable.LRU[snippetCacheKey, Snippet]
+	workspaceID int
+}
+
+// Entries are keyed by workspace as well as id, so a snippet cached for one
+// workspace is never served to another.
+type snippetCacheKey struct {
+	workspaceID int
+	id          int
+}
+
+// Wrap m with a cache holding up to size snippets, each for at most ttl.
+func NewCachedSnippetModel(m SnippetModelInterface, size int, ttl time.Duration) *CachedSnippetModel {
+	return &CachedSnippetModel{
+		SnippetModelInterface: m,
+		cache:                 expirable.NewLRU[snippetCacheKey, Snippet](size, nil, ttl),
+	}
+}
+
+// ForWorkspace returns a copy limited to the given workspace, sharing the
+// same cache.
+func (m *CachedSnippetModel) ForWorkspace(workspaceID int) SnippetModelInterface {
+	return &CachedSnippetModel{
+		SnippetModelInterface: m.SnippetModelInterface.ForWorkspace(workspaceID),
+		cache:                 m.cache,
+		workspaceID:           workspaceID,
+	}
+}
+
+// WithContext returns a copy whose queries run under ctx, sharing the same
+// cache.
+func (m *CachedSnippetModel) WithContext(ctx context.Context) SnippetModelInterface {
+	return &CachedSnippetModel{
+		SnippetModelInterface: m.SnippetModelInterface.WithContext(ctx),
+		cache:                 m.cache,
+		workspaceID:           m.workspaceID,
+	}
+}
+
+func (m *CachedSnippetModel) key(id int) snippetCacheKey {
+	workspaceID := m.workspaceID
+	if workspaceID == 0 {
+		workspaceID = DefaultWorkspaceID
+	}
+	return snippetCacheKey{workspaceID: workspaceID, id: id}
+}
+
+// Get returns the cached snippet if there is one which hasn't expired in the
+// meantime, and otherwise loads (and caches) it.
+func (m *CachedSnippetModel) Get(id int) (Snippet, error) {
+	if s, ok := m.cache.Get(m.key(id)); ok {
+		if s.Expires.After(time.Now()) {
+			return s, nil
+		}
+		m.cache.Remove(m.key(id))
+	}
+
+	s, err := m.SnippetModelInterface.Get(id)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	m.cache.Add(m.key(id), s)
+
+	return s, nil
+}
+
+func (m *CachedSnippetModel) Update(id int, title string, content string, version int) error {
+	defer m.cache.Remove(m.key(id))
+	return m.SnippetModelInterface.Update(id, title, content, version)
+}
+
+func (m *CachedSnippetModel) Delete(id int) error {
+	defer m.cache.Remove(m.key(id))
+	return m.SnippetModelInterface.Delete(id)
+}
+
+func (m *CachedSnippetModel) Restore(id int) error {
+	defer m.cache.Remove(m.key(id))
+	return m.SnippetModelInterface.Restore(id)
+}
+
+func (m *CachedSnippetModel) SetArchived(id int, archived bool) error {
+	defer m.cache.Remove(m.key(id))
+	return m.SnippetModelInterface.SetArchived(id, archived)
+}
+
+func (m *CachedSnippetModel) ExtendExpiry(id int, days int) error {
+	defer m.cache.Remove(m.key(id))
+	return m.SnippetModelInterface.ExtendExpiry(id, days)
+}
@@ -0,0 +1,249 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A spy standing in for the database behind the caching models, counting the
+// Gets and Queries which reach it.
+type spySnippetModel struct {
+	SnippetModelInterface
+	snippet Snippet
+	gets    int
+	queries int
+}
+
+func (m *spySnippetModel) ForWorkspace(int) SnippetModelInterface            { return m }
+func (m *spySnippetModel) WithContext(context.Context) SnippetModelInterface { return m }
+func (m *spySnippetModel) Update(int, string, string, int) error             { return nil }
+func (m *spySnippetModel) Delete(int) error                                  { return nil }
+func (m *spySnippetModel) Insert(string, string, int, int) (int, error)      { return 2, nil }
+
+func (m *spySnippetModel) InsertWithTags(string, string, int, int, []string) (int, error) {
+	return 2, nil
+}
+
+func (m *spySnippetModel) Get(id int) (Snippet, error) {
+	m.gets++
+	if id != m.snippet.ID {
+		return Snippet{}, ErrNoRecord
+	}
+	return m.snippet, nil
+}
+
+func (m *spySnippetModel) Query(f SnippetFilter) ([]Snippet, int, error) {
+	m.queries++
+	return []Snippet{m.snippet}, 1, nil
+}
+
+func newSpySnippetModel(expires time.Time) *spySnippetModel {
+	return &spySnippetModel{snippet: Snippet{ID: 1, Title: "Cached", Expires: expires}}
+}
+
+func TestCachedSnippetModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expires  time.Time
+		between  func(m SnippetModelInterface) error
+		wantGets int
+	}{
+		{
+			name:     "Second Get is cached",
+			expires:  time.Now().Add(time.Hour),
+			wantGets: 1,
+		},
+		{
+			name:     "Update evicts",
+			expires:  time.Now().Add(time.Hour),
+			between:  func(m SnippetModelInterface) error { return m.Update(1, "Edited", "Content", 1) },
+			wantGets: 2,
+		},
+		{
+			name:     "Delete evicts",
+			expires:  time.Now().Add(time.Hour),
+			between:  func(m SnippetModelInterface) error { return m.Delete(1) },
+			wantGets: 2,
+		},
+		{
+			name:     "Other workspace misses",
+			expires:  time.Now().Add(time.Hour),
+			between:  func(m SnippetModelInterface) error { _, err := m.ForWorkspace(2).Get(1); return err },
+			wantGets: 2,
+		},
+		{
+			name:     "Expired snippet isn't served",
+			expires:  time.Now().Add(-time.Minute),
+			wantGets: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spy := newSpySnippetModel(tt.expires)
+			m := NewCachedSnippetModel(spy, 10, time.Minute)
+
+			_, err := m.Get(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.between != nil {
+				err = tt.between(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s, err := m.Get(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Title != "Cached" {
+				t.Errorf("got title %q; want %q", s.Title, "Cached")
+			}
+
+			if spy.gets != tt.wantGets {
+				t.Errorf("got %d database Gets; want %d", spy.gets, tt.wantGets)
+			}
+		})
+	}
+}
+
+func TestCachedSnippetModelMiss(t *testing.T) {
+	spy := newSpySnippetModel(time.Now().Add(time.Hour))
+	m := NewCachedSnippetModel(spy, 10, time.Minute)
+
+	// Errors aren't cached, each lookup goes to the database.
+	for i := 0; i < 2; i++ {
+		_, err := m.Get(2)
+		if !errors.Is(err, ErrNoRecord) {
+			t.Fatalf("got error %v; want %v", err, ErrNoRecord)
+		}
+	}
+
+	if spy.gets != 2 {
+		t.Errorf("got %d database Gets; want 2", spy.gets)
+	}
+}
+
+func TestLatestCachedSnippetModel(t *testing.T) {
+	filter := SnippetFilter{Limit: 10, Sort: "newest"}
+
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		between     func(m SnippetModelInterface) error
+		wantQueries int
+	}{
+		{
+			name:        "Within the TTL",
+			ttl:         time.Minute,
+			wantQueries: 1,
+		},
+		{
+			name:        "After the TTL",
+			ttl:         0,
+			wantQueries: 2,
+		},
+		{
+			name:        "Create clears it",
+			ttl:         time.Minute,
+			between:     func(m SnippetModelInterface) error { _, err := m.Insert("New", "Content", 7, 0); return err },
+			wantQueries: 2,
+		},
+		{
+			name: "Create with tags clears it",
+			ttl:  time.Minute,
+			between: func(m SnippetModelInterface) error {
+				_, err := m.InsertWithTags("New", "Content", 7, 0, []string{"go"})
+				return err
+			},
+			wantQueries: 2,
+		},
+		{
+			name:        "Update clears it",
+			ttl:         time.Minute,
+			between:     func(m SnippetModelInterface) error { return m.Update(1, "Changed", "Content", 1) },
+			wantQueries: 2,
+		},
+		{
+			name:        "Delete clears it",
+			ttl:         time.Minute,
+			between:     func(m SnippetModelInterface) error { return m.Delete(1) },
+			wantQueries: 2,
+		},
+		{
+			name:        "Change in a workspace copy clears it",
+			ttl:         time.Minute,
+			between:     func(m SnippetModelInterface) error { return m.ForWorkspace(2).Delete(1) },
+			wantQueries: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spy := newSpySnippetModel(time.Now().Add(time.Hour))
+			m := NewLatestCachedSnippetModel(spy, tt.ttl)
+
+			_, _, err := m.Query(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.between != nil {
+				err = tt.between(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			snippets, total, err := m.Query(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snippets) != 1 || snippets[0].Title != "Cached" || total != 1 {
+				t.Errorf("got %v (total %d); want the spy's snippet", snippets, total)
+			}
+
+			if spy.queries != tt.wantQueries {
+				t.Errorf("got %d queries; want %d", spy.queries, tt.wantQueries)
+			}
+		})
+	}
+}
+
+func TestLatestCachedSnippetModelFilters(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      SnippetFilter
+		wantQueries int
+	}{
+		{"Plain listing", SnippetFilter{Limit: 10, Sort: "newest"}, 1},
+		{"Second page", SnippetFilter{Limit: 10, Offset: 10}, 3},
+		{"Search", SnippetFilter{Limit: 10, Search: "pond"}, 3},
+		{"Tag", SnippetFilter{Limit: 10, Tag: "go"}, 3},
+		{"Owner", SnippetFilter{Limit: 10, OwnerID: 1}, 3},
+		{"Expired", SnippetFilter{Limit: 10, IncludeExpired: true}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spy := newSpySnippetModel(time.Now().Add(time.Hour))
+			m := NewLatestCachedSnippetModel(spy, time.Minute)
+
+			for i := 0; i < 3; i++ {
+				_, _, err := m.Query(tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if spy.queries != tt.wantQueries {
+				t.Errorf("got %d queries; want %d", spy.queries, tt.wantQueries)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Upper bound for any single model query.
+const queryTimeout = 5 * time.Second
+
+// A QueryHook is called after each model query with the context the query
+// ran for (e.g. the request's, as set with WithContext), the statement text
+// and how long the query took. Models have none by default, and a nil hook
+// skips the timing entirely.
+type QueryHook func(ctx context.Context, stmt string, elapsed time.Duration)
+
+// Start timing stmt. Call the returned function once the query is done, e.g.
+// defer m.QueryHook.observe(m.baseContext(), stmt)().
+func (h QueryHook) observe(ctx context.Context, stmt string) func() {
+	if h == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		h(ctx, stmt, time.Since(start))
+	}
+}
+
+// Map errors returned by database/sql onto the models package's own errors.
+// Missing rows become ErrNoRecord and context deadline/cancellation become
+// ErrTimeout (still wrapping the original), so handlers can branch on them
+// with errors.Is. Anything else is wrapped, so the driver error can still be
+// reached with errors.As.
+func classifyError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNoRecord
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	default:
+		return fmt.Errorf("models: database error: %w", err)
+	}
+}
+
+// MySQL error numbers the models act on.
+const (
+	mySQLDuplicateEntry  = 1062
+	mySQLLockWaitTimeout = 1205
+	mySQLDeadlock        = 1213
+)
+
+// Return the MySQL error number behind err, or 0 if it isn't a MySQL error.
+func mySQLErrorNumber(err error) uint16 {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number
+	}
+	return 0
+}
+
+// Report whether err is a duplicate entry (1062) on the named unique key.
+func isDuplicateKey(err error, key string) bool {
+	return mySQLErrorNumber(err) == mySQLDuplicateEntry && strings.Contains(err.Error(), key)
+}
+
+// Report whether err is a MySQL deadlock (1213) or lock wait timeout (1205).
+// Both mean the transaction was rolled back and is safe to run again.
+func isDeadlock(err error) bool {
+	number := mySQLErrorNumber(err)
+	return number == mySQLDeadlock || number == mySQLLockWaitTimeout
+}
+
+// Run fn, retrying it a few times with a short jittered pause if it fails with
+// a deadlock. Any other error (or success) is returned immediately.
+func withDeadlockRetry(fn func() error) error {
+	const attempts = 3
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = fn()
+		if !isDeadlock(err) || attempt == attempts {
+			break
+		}
+
+		time.Sleep(time.Duration(attempt*10+rand.Intn(20)) * time.Millisecond)
+	}
+
+	return err
+}
+
+// Run fn inside a transaction on db. The transaction is committed if fn
+// returns nil and rolled back otherwise. A panic inside fn also rolls back,
+// after which the panic is re-raised for the caller's recovery to handle.
+func withTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		// The rollback error (if any) is less useful than the original one.
+		tx.Rollback()
+		return err
+	}
+
+	return classifyError(tx.Commit())
+}
+
+// Check whether a table is present in the current database.
+func tableExists(db *sql.DB, name string) (bool, error) {
+	stmt := `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`
+
+	var count int
+	err := db.QueryRow(stmt, name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Report whether the named column exists on a table in the current database.
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	stmt := `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+
+	var count int
+	err := db.QueryRow(stmt, table, column).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Add a column to a table created before the column existed, with the given
+// type and default. It does nothing if the column is already there, so it's
+// safe to run every time.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	exists, err := columnExists(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
@@ -0,0 +1,336 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestWithDeadlockRetry(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: mySQLDeadlock, Message: "Deadlock found when trying to get lock"}
+	lockWait := &mysql.MySQLError{Number: mySQLLockWaitTimeout, Message: "Lock wait timeout exceeded"}
+	duplicate := &mysql.MySQLError{Number: mySQLDuplicateEntry, Message: "Duplicate entry"}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "Success",
+			errs:      []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "Deadlock then success",
+			errs:      []error{deadlock, nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "Lock wait timeout then success",
+			errs:      []error{lockWait, lockWait, nil},
+			wantCalls: 3,
+		},
+		{
+			name:      "Deadlock every time",
+			errs:      []error{deadlock, deadlock, deadlock},
+			wantCalls: 3,
+			wantErr:   deadlock,
+		},
+		{
+			name:      "Not retryable",
+			errs:      []error{duplicate, nil},
+			wantCalls: 1,
+			wantErr:   duplicate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+
+			err := withDeadlockRetry(func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls; want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// A database/sql driver which only supports transactions, counting how each
+// one ended.
+type txCounter struct {
+	commits, rollbacks int
+}
+
+func (c *txCounter) Connect(context.Context) (driver.Conn, error) { return txCounterConn{c}, nil }
+func (c *txCounter) Driver() driver.Driver                        { return nil }
+
+type txCounterConn struct{ c *txCounter }
+
+func (conn txCounterConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("txCounter: queries not supported")
+}
+func (conn txCounterConn) Close() error              { return nil }
+func (conn txCounterConn) Begin() (driver.Tx, error) { return txCounterTx(conn), nil }
+
+type txCounterTx struct{ c *txCounter }
+
+func (tx txCounterTx) Commit() error   { tx.c.commits++; return nil }
+func (tx txCounterTx) Rollback() error { tx.c.rollbacks++; return nil }
+
+func TestWithTx(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name          string
+		fn            func(*sql.Tx) error
+		wantErr       error
+		wantPanic     bool
+		wantCommits   int
+		wantRollbacks int
+	}{
+		{
+			name:        "Success",
+			fn:          func(*sql.Tx) error { return nil },
+			wantCommits: 1,
+		},
+		{
+			name:          "Error",
+			fn:            func(*sql.Tx) error { return errFailed },
+			wantErr:       errFailed,
+			wantRollbacks: 1,
+		},
+		{
+			name:          "Panic",
+			fn:            func(*sql.Tx) error { panic("boom") },
+			wantPanic:     true,
+			wantRollbacks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c txCounter
+			db := sql.OpenDB(&c)
+			defer db.Close()
+
+			var err error
+			panicked := func() (panicked bool) {
+				defer func() {
+					panicked = recover() != nil
+				}()
+				err = withTx(context.Background(), db, tt.fn)
+				return false
+			}()
+
+			if panicked != tt.wantPanic {
+				t.Errorf("got panic %t; want %t", panicked, tt.wantPanic)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+			if c.commits != tt.wantCommits || c.rollbacks != tt.wantRollbacks {
+				t.Errorf("got %d commits and %d rollbacks; want %d and %d", c.commits, c.rollbacks, tt.wantCommits, tt.wantRollbacks)
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	driverErr := &mysql.MySQLError{Number: 1146, Message: "Table 'snippetbox.snippets' doesn't exist"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{"No error", nil, nil},
+		{"No rows", sql.ErrNoRows, ErrNoRecord},
+		{"Deadline exceeded", context.DeadlineExceeded, ErrTimeout},
+		{"Cancelled context", ctx.Err(), ErrTimeout},
+		{"Driver error", driverErr, driverErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.err)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil || tt.wantErr == ErrNoRecord {
+				return
+			}
+
+			// Timeouts and driver errors still wrap the original.
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v; want it to wrap %v", err, tt.err)
+			}
+			if errors.Is(err, ErrTimeout) != (tt.wantErr == ErrTimeout) {
+				t.Errorf("got error %v; want ErrTimeout only for timeouts", err)
+			}
+		})
+	}
+}
+
+// A database/sql driver whose every statement fails with err, so a test can
+// tell from the error which pool a query went to.
+type failingPool struct{ err error }
+
+func (p failingPool) Connect(context.Context) (driver.Conn, error) { return failingConn(p), nil }
+func (p failingPool) Driver() driver.Driver                        { return nil }
+
+type failingConn struct{ err error }
+
+func (conn failingConn) Prepare(string) (driver.Stmt, error) { return nil, conn.err }
+func (conn failingConn) Close() error                        { return nil }
+func (conn failingConn) Begin() (driver.Tx, error)           { return nil, conn.err }
+
+func TestQueryHook(t *testing.T) {
+	db := sql.OpenDB(failingPool{errors.New("unreachable")})
+	defer db.Close()
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+
+	var gotCtx context.Context
+	var gotStmt string
+
+	m := &SnippetModel{DB: db}
+	m.QueryHook = func(ctx context.Context, stmt string, elapsed time.Duration) {
+		gotCtx, gotStmt = ctx, stmt
+	}
+
+	// The hook runs even when the query fails, with the model's context.
+	m.WithContext(ctx).Get(1)
+
+	if gotStmt != getSnippetStmt {
+		t.Errorf("got stmt %q; want %q", gotStmt, getSnippetStmt)
+	}
+	if gotCtx == nil || gotCtx.Value(ctxKey{}) != "request" {
+		t.Error("hook didn't get the context set with WithContext")
+	}
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	duplicateEmail := &mysql.MySQLError{Number: mySQLDuplicateEntry, Message: "Duplicate entry 'alice@example.com' for key 'users.users_uc_email'"}
+	duplicatePrimary := &mysql.MySQLError{Number: mySQLDuplicateEntry, Message: "Duplicate entry '1-2' for key 'favorites.PRIMARY'"}
+	otherError := &mysql.MySQLError{Number: 1146, Message: "Table 'snippetbox.users_uc_email' doesn't exist"}
+
+	tests := []struct {
+		name string
+		err  error
+		key  string
+		want bool
+	}{
+		{"Matching key", duplicateEmail, "users_uc_email", true},
+		{"Wrapped", fmt.Errorf("inserting user: %w", duplicateEmail), "users_uc_email", true},
+		{"Other key", duplicatePrimary, "users_uc_email", false},
+		{"Primary key", duplicatePrimary, "PRIMARY", true},
+		{"Other error number", otherError, "users_uc_email", false},
+		{"Not a driver error", errors.New("Duplicate entry for key 'users_uc_email'"), "users_uc_email", false},
+		{"No error", nil, "users_uc_email", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDuplicateKey(tt.err, tt.key); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelErrorMapping(t *testing.T) {
+	duplicateEmail := &mysql.MySQLError{Number: mySQLDuplicateEntry, Message: "Duplicate entry 'alice@example.com' for key 'users.users_uc_email'"}
+	duplicateSlug := &mysql.MySQLError{Number: mySQLDuplicateEntry, Message: "Duplicate entry 'a-title' for key 'snippets.idx_snippets_slug'"}
+	missingTable := &mysql.MySQLError{Number: 1146, Message: "Table 'snippetbox.snippets' doesn't exist"}
+
+	tests := []struct {
+		name    string
+		err     error
+		call    func(db *sql.DB) error
+		wantErr error
+	}{
+		{
+			name: "Duplicate email",
+			err:  duplicateEmail,
+			call: func(db *sql.DB) error {
+				_, err := (&UserModel{DB: db}).Insert("Alice", "alice@example.com", "pa$$word1")
+				return err
+			},
+			wantErr: ErrDuplicateEmail,
+		},
+		{
+			name: "Duplicate on another user key",
+			err:  duplicateSlug,
+			call: func(db *sql.DB) error {
+				_, err := (&UserModel{DB: db}).Insert("Alice", "alice@example.com", "pa$$word1")
+				return err
+			},
+			wantErr: duplicateSlug,
+		},
+		{
+			name: "Duplicate snippet",
+			err:  duplicateSlug,
+			call: func(db *sql.DB) error {
+				_, err := (&SnippetModel{DB: db}).Insert("A title", "Content", 7, 0)
+				return err
+			},
+			wantErr: ErrDuplicate,
+		},
+		{
+			name: "Duplicate snippet with tags",
+			err:  duplicateSlug,
+			call: func(db *sql.DB) error {
+				_, err := (&SnippetModel{DB: db}).InsertWithTags("A title", "Content", 7, 0, []string{"go"})
+				return err
+			},
+			wantErr: ErrDuplicate,
+		},
+		{
+			name:    "Other driver error",
+			err:     missingTable,
+			call:    func(db *sql.DB) error { _, err := (&SnippetModel{DB: db}).Get(1); return err },
+			wantErr: missingTable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sql.OpenDB(failingPool{tt.err})
+			defer db.Close()
+
+			err := tt.call(db)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+
+			// Unmapped driver errors can still be inspected.
+			var mySQLError *mysql.MySQLError
+			if tt.wantErr == tt.err && !errors.As(err, &mySQLError) {
+				t.Errorf("got error %v; want it to wrap a *mysql.MySQLError", err)
+			}
+		})
+	}
+}
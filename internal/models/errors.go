@@ -5,3 +5,38 @@ import (
 )
 
 var ErrNoRecord = errors.New("models: no matching record found")
+
+// Returned by Update when the version supplied by the caller no longer
+// matches the stored row, i.e. someone else saved the snippet first.
+var ErrEditConflict = errors.New("models: edit conflict")
+
+// Returned when a query was abandoned because its context deadline passed or
+// the context was cancelled, as opposed to the database reporting an error.
+var ErrTimeout = errors.New("models: query timed out")
+
+// Returned by UserModel.Insert when the email address is already taken.
+var ErrDuplicateEmail = errors.New("models: duplicate email")
+
+// Returned by SnippetModel.Insert when the new row collides with a unique key
+// (MySQL error 1062), e.g. when two inserts race.
+var ErrDuplicate = errors.New("models: duplicate record")
+
+// Returned by UserModel.Authenticate when the email or password is wrong.
+var ErrInvalidCredentials = errors.New("models: invalid credentials")
+
+// Returned by SnippetModel.Query for a sort key it doesn't know.
+var ErrInvalidSort = errors.New("models: invalid sort")
+
+// Returned by SnippetModel.Insert and ExtendExpiry for a number of days not
+// in PermittedExpiries.
+var ErrInvalidExpiry = errors.New("models: invalid expiry")
+
+// Returned when a user already has as many snippets as their quota allows.
+var ErrQuotaExceeded = errors.New("models: quota exceeded")
+
+// Returned by VerifyShareLink for a token which is malformed, has been
+// tampered with or has expired.
+var ErrInvalidShareLink = errors.New("models: invalid share link")
+
+// Returned by UserModel.AuthenticateToken for an unknown or revoked token.
+var ErrInvalidToken = errors.New("models: invalid API token")
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LatestCachedSnippetModel keeps the first page of the plain listings (no
+// search, tag, owner or expired filter, as on the home page) in memory for a
+// short TTL, so bursts of traffic don't each query the database. Any change
+// to a snippet clears the whole cache, for every workspace. Like
+// CachedSnippetModel it's per process, so other instances can lag behind by
+// up to the TTL.
+type LatestCachedSnippetModel struct {
+	SnippetModelInterface
+	cache       *latestCache
+	workspaceID int
+}
+
+type latestCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[latestCacheKey]latestCacheEntry
+	// Bumped on every invalidation, so a query which was already running
+	// when a snippet changed doesn't store its (possibly stale) result.
+	generation uint64
+}
+
+// Only the parts of a filter which can vary for a cached query make up the
+// key, along with the workspace.
+type latestCacheKey struct {
+	workspaceID int
+	limit       int
+	sort        string
+}
+
+type latestCacheEntry struct {
+	snippets []Snippet
+	total    int
+	expires  time.Time
+}
+
+// Wrap m with a cache of the latest listings, each kept for ttl.
+func NewLatestCachedSnippetModel(m SnippetModelInterface, ttl time.Duration) *LatestCachedSnippetModel {
+	return &LatestCachedSnippetModel{
+		SnippetModelInterface: m,
+		cache: &latestCache{
+			ttl:     ttl,
+			entries: make(map[latestCacheKey]latestCacheEntry),
+		},
+	}
+}
+
+// ForWorkspace returns a copy limited to the given workspace, sharing the
+// same cache.
+func (m *LatestCachedSnippetModel) ForWorkspace(workspaceID int) SnippetModelInterface {
+	return &LatestCachedSnippetModel{
+		SnippetModelInterface: m.SnippetModelInterface.ForWorkspace(workspaceID),
+		cache:                 m.cache,
+		workspaceID:           workspaceID,
+	}
+}
+
+// WithContext returns a copy whose queries run under ctx, sharing the same
+// cache.
+func (m *LatestCachedSnippetModel) WithContext(ctx context.Context) SnippetModelInterface {
+	return &LatestCachedSnippetModel{
+		SnippetModelInterface: m.SnippetModelInterface.WithContext(ctx),
+		cache:                 m.cache,
+		workspaceID:           m.workspaceID,
+	}
+}
+
+// Return the cache key for a filter, and whether it's one which is cached at
+// all.
+func (m *LatestCachedSnippetModel) key(f SnippetFilter) (latestCacheKey, bool) {
+	if f.Offset != 0 || f.Search != "" || f.Tag != "" || f.OwnerID != 0 || f.IncludeExpired {
+		return latestCacheKey{}, false
+	}
+
+	workspaceID := m.workspaceID
+	if workspaceID == 0 {
+		workspaceID = DefaultWorkspaceID
+	}
+
+	return latestCacheKey{workspaceID: workspaceID, limit: f.Limit, sort: f.Sort}, true
+}
+
+// Query answers the first page of a plain listing from the cache while it's
+// fresh, and otherwise loads (and caches) it. Other filters go straight to
+// the wrapped model.
+func (m *LatestCachedSnippetModel) Query(f SnippetFilter) ([]Snippet, int, error) {
+	key, ok := m.key(f)
+	if !ok {
+		return m.SnippetModelInterface.Query(f)
+	}
+
+	m.cache.mu.Lock()
+	entry, found := m.cache.entries[key]
+	generation := m.cache.generation
+	m.cache.mu.Unlock()
+
+	if found && time.Now().Before(entry.expires) {
+		return slices.Clone(entry.snippets), entry.total, nil
+	}
+
+	snippets, total, err := m.SnippetModelInterface.Query(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	m.cache.mu.Lock()
+	if m.cache.generation == generation {
+		m.cache.entries[key] = latestCacheEntry{
+			snippets: slices.Clone(snippets),
+			total:    total,
+			expires:  time.Now().Add(m.cache.ttl),
+		}
+	}
+	m.cache.mu.Unlock()
+
+	return snippets, total, nil
+}
+
+// Empty the cache, after a change which could show in a listing.
+func (m *LatestCachedSnippetModel) invalidate() {
+	m.cache.mu.Lock()
+	clear(m.cache.entries)
+	m.cache.generation++
+	m.cache.mu.Unlock()
+}
+
+func (m *LatestCachedSnippetModel) Insert(title string, content string, expires int, userID int) (int, error) {
+	defer m.invalidate()
+	return m.SnippetModelInterface.Insert(title, content, expires, userID)
+}
+
+func (m *LatestCachedSnippetModel) InsertWithTags(title string, content string, expires int, userID int, tags []string) (int, error) {
+	defer m.invalidate()
+	return m.SnippetModelInterface.InsertWithTags(title, content, expires, userID, tags)
+}
+
+func (m *LatestCachedSnippetModel) Update(id int, title string, content string, version int) error {
+	defer m.invalidate()
+	return m.SnippetModelInterface.Update(id, title, content, version)
+}
+
+func (m *LatestCachedSnippetModel) Delete(id int) error {
+	defer m.invalidate()
+	return m.SnippetModelInterface.Delete(id)
+}
+
+func (m *LatestCachedSnippetModel) Restore(id int) error {
+	defer m.invalidate()
+	return m.SnippetModelInterface.Restore(id)
+}
+
+func (m *LatestCachedSnippetModel) DeleteExpired() (int, error) {
+	defer m.invalidate()
+	return m.SnippetModelInterface.DeleteExpired()
+}
+
+func (m *LatestCachedSnippetModel) SetArchived(id int, archived bool) error {
+	defer m.invalidate()
+	return m.SnippetModelInterface.SetArchived(id, archived)
+}
+
+func (m *LatestCachedSnippetModel) ExtendExpiry(id int, days int) error {
+	defer m.invalidate()
+	return m.SnippetModelInterface.ExtendExpiry(id, days)
+}
@@ -0,0 +1,39 @@
+package mocks
+
+import (
+	"sync"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+// AuditModel is an in-memory stand-in for models.AuditModel. It keeps the
+// entries logged through it, so each test should use its own and can read
+// them back with Page.
+type AuditModel struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (m *AuditModel) LogAction(e models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = len(m.entries) + 1
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *AuditModel) Page(workspaceID, limit, offset int) ([]models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []models.AuditEntry
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if m.entries[i].WorkspaceID == workspaceID {
+			entries = append(entries, m.entries[i])
+		}
+	}
+
+	entries = entries[min(offset, len(entries)):]
+	return entries[:min(limit, len(entries))], nil
+}
@@ -0,0 +1,71 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+// ReportModel is an in-memory stand-in for models.ReportModel. Reports from
+// the same IP on the same snippet are always deduplicated, whatever the
+// window, and each test should use its own.
+type ReportModel struct {
+	mu      sync.Mutex
+	reports []report
+}
+
+type report struct {
+	models.Report
+	workspaceID int
+	resolved    bool
+}
+
+func (m *ReportModel) Insert(workspaceID, snippetID int, reason, ip string, dedupe time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rp := range m.reports {
+		if rp.workspaceID == workspaceID && rp.SnippetID == snippetID && rp.ReporterIP == ip {
+			return false, nil
+		}
+	}
+
+	m.reports = append(m.reports, report{
+		Report: models.Report{
+			ID:           len(m.reports) + 1,
+			SnippetID:    snippetID,
+			SnippetTitle: mockSnippet.Title,
+			Reason:       reason,
+			ReporterIP:   ip,
+			Created:      time.Now().UTC(),
+		},
+		workspaceID: workspaceID,
+	})
+	return true, nil
+}
+
+func (m *ReportModel) Open(workspaceID int) ([]models.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reports []models.Report
+	for _, rp := range m.reports {
+		if rp.workspaceID == workspaceID && !rp.resolved {
+			reports = append(reports, rp.Report)
+		}
+	}
+	return reports, nil
+}
+
+func (m *ReportModel) Resolve(workspaceID, snippetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.reports {
+		if m.reports[i].workspaceID == workspaceID && m.reports[i].SnippetID == snippetID {
+			m.reports[i].resolved = true
+		}
+	}
+	return nil
+}
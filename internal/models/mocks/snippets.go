@@ -0,0 +1,302 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+// The one snippet the mock starts out with. Every other id behaves as
+// missing until a snippet is inserted.
+var mockSnippet = models.Snippet{
+	ID:      1,
+	Title:   "An old silent pond",
+	Content: "An old silent pond...",
+	Created: time.Now(),
+	Expires: time.Now(),
+	Version: 1,
+	UserID:  1,
+}
+
+// SnippetModel is an in-memory stand-in for models.SnippetModel, returning
+// canned data so handlers can be exercised without a database. The last
+// snippet inserted (always given id 2) is kept so it can be read back, along
+// with its tags, as are the users who have favorited the mock snippet and the
+// versions updates to it would have made, so each test should use its own.
+type SnippetModel struct {
+	mu        sync.Mutex
+	inserted  *models.Snippet
+	tags      []string
+	favorites map[int]bool
+	updates   []models.SnippetVersion
+}
+
+func (m *SnippetModel) Insert(title string, content string, expires int, userID int) (int, error) {
+	if !slices.Contains(models.PermittedExpiries, expires) {
+		return 0, models.ErrInvalidExpiry
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.inserted = &models.Snippet{
+		ID:      2,
+		Title:   title,
+		Content: content,
+		Created: now,
+		Expires: now.AddDate(0, 0, expires),
+		Version: 1,
+		UserID:  userID,
+	}
+	return m.inserted.ID, nil
+}
+
+func (m *SnippetModel) InsertWithTags(title string, content string, expires int, userID int, tags []string) (int, error) {
+	id, err := m.Insert(title, content, expires, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tags = slices.Clone(tags)
+	return id, nil
+}
+
+func (m *SnippetModel) Update(id int, title string, content string, version int) error {
+	if id != mockSnippet.ID {
+		return models.ErrNoRecord
+	}
+	if version != mockSnippet.Version {
+		return models.ErrEditConflict
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updates = append(m.updates, models.SnippetVersion{Version: mockSnippet.Version + len(m.updates) + 1, Title: title, Content: content})
+	return nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	if id != mockSnippet.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) Restore(id int) error {
+	if id != mockSnippet.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) ExtendExpiry(id int, days int) error {
+	if id != mockSnippet.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) OwnerID(id int) (int, error) {
+	if id != mockSnippet.ID {
+		return 0, models.ErrNoRecord
+	}
+	return mockSnippet.UserID, nil
+}
+
+// Pretend there were two expired snippets to remove.
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	return 2, nil
+}
+
+func (m *SnippetModel) SetArchived(id int, archived bool) error {
+	if id != mockSnippet.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *SnippetModel) Get(id int) (models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case id == mockSnippet.ID:
+		return mockSnippet, nil
+	case m.inserted != nil && id == m.inserted.ID:
+		return *m.inserted, nil
+	default:
+		return models.Snippet{}, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) GetFromPrimary(id int) (models.Snippet, error) {
+	return m.Get(id)
+}
+
+func (m *SnippetModel) TitleExists(title string) (bool, error) {
+	return strings.EqualFold(strings.TrimSpace(title), mockSnippet.Title), nil
+}
+
+func (m *SnippetModel) Latest(c int) ([]models.Snippet, error) {
+	return []models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) Query(f models.SnippetFilter) ([]models.Snippet, int, error) {
+	if f.Sort != "" && !slices.Contains(models.SnippetSorts, f.Sort) {
+		return nil, 0, models.ErrInvalidSort
+	}
+	if f.Search != "" && !strings.Contains(strings.ToLower(mockSnippet.Title+"\n"+mockSnippet.Content), strings.ToLower(f.Search)) {
+		return nil, 0, nil
+	}
+	if f.OwnerID != 0 && f.OwnerID != mockSnippet.UserID {
+		return nil, 0, nil
+	}
+	if f.Offset > 0 {
+		return nil, 1, nil
+	}
+	return []models.Snippet{mockSnippet}, 1, nil
+}
+
+func (m *SnippetModel) Count(f models.SnippetFilter) (int, error) {
+	_, total, err := m.Query(f)
+	return total, err
+}
+
+func (m *SnippetModel) After(cursor, limit int) ([]models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Newest first: the inserted snippet, if any, then the mock one.
+	all := []models.Snippet{mockSnippet}
+	if m.inserted != nil {
+		all = []models.Snippet{*m.inserted, mockSnippet}
+	}
+
+	var snippets []models.Snippet
+	for _, s := range all {
+		if (cursor == 0 || s.ID < cursor) && len(snippets) < limit {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) ForWorkspace(workspaceID int) models.SnippetModelInterface {
+	return m
+}
+
+func (m *SnippetModel) WithContext(ctx context.Context) models.SnippetModelInterface {
+	return m
+}
+
+func (m *SnippetModel) ExistsMany(ids []int) (map[int]bool, error) {
+	exists := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		exists[id] = id == mockSnippet.ID
+	}
+	return exists, nil
+}
+
+func (m *SnippetModel) CountByUser(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	if userID == mockSnippet.UserID {
+		count++
+	}
+	if m.inserted != nil && m.inserted.UserID == userID {
+		count++
+	}
+	return count, nil
+}
+
+func (m *SnippetModel) ToggleFavorite(userID, snippetID int) (bool, error) {
+	if snippetID != mockSnippet.ID {
+		return false, models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.favorites == nil {
+		m.favorites = map[int]bool{}
+	}
+	m.favorites[userID] = !m.favorites[userID]
+	return m.favorites[userID], nil
+}
+
+func (m *SnippetModel) FavoritesByUser(userID int) ([]models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.favorites[userID] {
+		return []models.Snippet{mockSnippet}, nil
+	}
+	return nil, nil
+}
+
+func (m *SnippetModel) Versions(id int) ([]models.SnippetVersion, error) {
+	if id != mockSnippet.ID {
+		return nil, models.ErrNoRecord
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := []models.SnippetVersion{{Version: mockSnippet.Version, Title: mockSnippet.Title, Content: mockSnippet.Content}}
+	return append(versions, m.updates...), nil
+}
+
+func (m *SnippetModel) Tags(id int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.inserted == nil || id != m.inserted.ID {
+		return nil, nil
+	}
+
+	tags := slices.Clone(m.tags)
+	slices.Sort(tags)
+	return tags, nil
+}
+
+func (m *SnippetModel) RenameTag(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(m.tags, from) {
+		return models.ErrNoRecord
+	}
+
+	m.tags = slices.DeleteFunc(m.tags, func(tag string) bool { return tag == from })
+	if !slices.Contains(m.tags, to) {
+		m.tags = append(m.tags, to)
+	}
+	return nil
+}
+
+func (m *SnippetModel) DeleteTag(tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(m.tags, tag) {
+		return models.ErrNoRecord
+	}
+
+	m.tags = slices.DeleteFunc(m.tags, func(t string) bool { return t == tag })
+	return nil
+}
+
+func (m *SnippetModel) Random() (models.Snippet, error) {
+	return mockSnippet, nil
+}
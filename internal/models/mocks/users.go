@@ -0,0 +1,89 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/joshuagageellis/snippetbox.git/internal/models"
+)
+
+// The one user the mock knows about, who owns mockSnippet, and the password
+// and API token which authenticate as them.
+var mockUser = models.User{
+	ID:          1,
+	Name:        "Alice",
+	Email:       "alice@example.com",
+	Created:     time.Now(),
+	WorkspaceID: models.DefaultWorkspaceID,
+}
+
+const (
+	mockPassword = "pa$$word1"
+	MockAPIToken = "valid-api-token"
+)
+
+// UserModel is an in-memory stand-in for models.UserModel. The only state it
+// keeps is whether the user is an admin and whether their API tokens have
+// been revoked, so each test should use its own.
+type UserModel struct {
+	admin         bool
+	tokensRevoked bool
+}
+
+// Return the mock user with the current admin flag.
+func (m *UserModel) user() models.User {
+	user := mockUser
+	user.IsAdmin = m.admin
+	return user
+}
+
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	switch email {
+	case "dupe@example.com":
+		return 0, models.ErrDuplicateEmail
+	default:
+		return 2, nil
+	}
+}
+
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	if email == mockUser.Email && password == mockPassword {
+		return mockUser.ID, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
+
+func (m *UserModel) SetAdmin(id int, admin bool) error {
+	if id != mockUser.ID {
+		return models.ErrNoRecord
+	}
+	m.admin = admin
+	return nil
+}
+
+func (m *UserModel) Get(id int) (models.User, error) {
+	if id != mockUser.ID {
+		return models.User{}, models.ErrNoRecord
+	}
+	return m.user(), nil
+}
+
+func (m *UserModel) NewAPIToken(userID int) (string, error) {
+	if userID == mockUser.ID {
+		m.tokensRevoked = false
+	}
+	return MockAPIToken, nil
+}
+
+func (m *UserModel) AuthenticateToken(token string) (models.User, error) {
+	if token != MockAPIToken || m.tokensRevoked {
+		return models.User{}, models.ErrInvalidToken
+	}
+	return m.user(), nil
+}
+
+func (m *UserModel) RevokeAPITokens(userID int) error {
+	if userID == mockUser.ID {
+		m.tokensRevoked = true
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import "testing"
+
+// Compare Get with and without a prepared statement. Run them against a real
+// server, e.g. TEST_DSN=... go test -run=^$ -bench=Get ./internal/models
+
+func BenchmarkPreparedGet(b *testing.B) {
+	m := &SnippetModel{DB: newTestDB(b)}
+
+	id, err := m.Insert("Benchmark", "Content", 7, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	prepared, err := NewPreparedSnippetModel(m)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { prepared.Close() })
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := prepared.Get(id)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAdhocGet(b *testing.B) {
+	m := &SnippetModel{DB: newTestDB(b)}
+
+	id, err := m.Insert("Benchmark", "Content", 7, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := m.Get(id)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
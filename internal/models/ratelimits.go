@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Define a RateLimitModel type which keeps per-key request counters in the
+// rate_limits table, so that every app instance shares the same counts.
+type RateLimitModel struct {
+	DB *sql.DB
+}
+
+// Hit increments the counter for key in the window starting at windowStart
+// and returns it, along with the final count of the window starting at
+// previousStart (0 if there were no hits then). Window starts are stored to the
+// second, so they must fall on whole seconds.
+func (m *RateLimitModel) Hit(key string, windowStart, previousStart time.Time) (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `INSERT INTO rate_limits (rl_key, window_start, hits) VALUES (?, ?, 1)
+	ON DUPLICATE KEY UPDATE hits = hits + 1`
+
+	err := withDeadlockRetry(func() error {
+		_, err := m.DB.ExecContext(ctx, stmt, key, windowStart.UTC())
+		return err
+	})
+	if err != nil {
+		return 0, 0, classifyError(err)
+	}
+
+	stmt = `SELECT window_start, hits FROM rate_limits
+	WHERE rl_key = ? AND window_start IN (?, ?)`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, key, windowStart.UTC(), previousStart.UTC())
+	if err != nil {
+		return 0, 0, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var current, previous int
+
+	for rows.Next() {
+		var start time.Time
+		var hits int
+
+		err = rows.Scan(&start, &hits)
+		if err != nil {
+			return 0, 0, classifyError(err)
+		}
+
+		if start.Equal(windowStart.UTC()) {
+			current = hits
+		} else {
+			previous = hits
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, 0, classifyError(err)
+	}
+
+	return current, previous, nil
+}
+
+// Cleanup removes counters for windows which started before the given time.
+func (m *RateLimitModel) Cleanup(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM rate_limits WHERE window_start < ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, before.UTC())
+	return classifyError(err)
+}
+
+// Create rate_limits table if it does not exist.
+func (m *RateLimitModel) CreateRateLimitTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			rl_key VARCHAR(255) NOT NULL,
+			window_start DATETIME NOT NULL,
+			hits INTEGER NOT NULL,
+			PRIMARY KEY (rl_key, window_start)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Dev seed database.
+func (m *RateLimitModel) SeedDatabase() error {
+	exists, err := tableExists(m.DB, "rate_limits")
+	if err != nil || exists {
+		return err
+	}
+
+	return m.CreateRateLimitTable()
+}
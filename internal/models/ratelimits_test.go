@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitModelHit(t *testing.T) {
+	m := &RateLimitModel{DB: newTestDB(t)}
+
+	err := m.SeedDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Now().UTC().Truncate(time.Minute)
+	second := first.Add(time.Minute)
+
+	for want := 1; want <= 3; want++ {
+		current, previous, err := m.Hit("1.2.3.4", first, first.Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current != want || previous != 0 {
+			t.Errorf("got %d, %d; want %d, 0", current, previous, want)
+		}
+	}
+
+	// A new window starts counting again, with the last one as previous.
+	current, previous, err := m.Hit("1.2.3.4", second, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 1 || previous != 3 {
+		t.Errorf("new window: got %d, %d; want 1, 3", current, previous)
+	}
+
+	err = m.Cleanup(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, previous, err = m.Hit("1.2.3.4", second, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 2 || previous != 0 {
+		t.Errorf("after cleanup: got %d, %d; want 2, 0", current, previous)
+	}
+}
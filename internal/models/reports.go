@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Define a Report type, a user's flag on a snippet for moderators to review.
+// SnippetTitle is filled in by Open, for display.
+type Report struct {
+	ID           int
+	SnippetID    int
+	SnippetTitle string
+	Reason       string
+	ReporterIP   string
+	Created      time.Time
+}
+
+// ReportModelInterface describes the report methods the web handlers use,
+// so they can be given a mock instead of a database-backed ReportModel.
+type ReportModelInterface interface {
+	Insert(workspaceID, snippetID int, reason, ip string, dedupe time.Duration) (bool, error)
+	Open(workspaceID int) ([]Report, error)
+	Resolve(workspaceID, snippetID int) error
+}
+
+// Define a ReportModel type which wraps a database connection pool.
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert records a report on a snippet, unless the same IP already reported
+// it within the dedupe window. It reports whether a new report was stored.
+func (m *ReportModel) Insert(workspaceID, snippetID int, reason, ip string, dedupe time.Duration) (bool, error) {
+	stmt := `INSERT INTO reports (workspace_id, snippet_id, reason, reporter_ip, created)
+	SELECT ?, ?, ?, ?, UTC_TIMESTAMP() FROM DUAL
+	WHERE NOT EXISTS (
+		SELECT true FROM reports
+		WHERE snippet_id = ? AND reporter_ip = ? AND created > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)
+	)`
+
+	var result sql.Result
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancel()
+
+		var err error
+		result, err = m.DB.ExecContext(ctx, stmt, workspaceID, snippetID, reason, ip, snippetID, ip, int(dedupe.Seconds()))
+		return err
+	})
+	if err != nil {
+		return false, classifyError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Open returns the unresolved reports in a workspace, oldest first, for
+// snippets which haven't been deleted.
+func (m *ReportModel) Open(workspaceID int) ([]Report, error) {
+	stmt := `SELECT r.id, r.snippet_id, s.title, r.reason, r.reporter_ip, r.created
+	FROM reports r INNER JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.workspace_id = ? AND r.resolved = FALSE AND s.deleted_at IS NULL
+	ORDER BY r.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, workspaceID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var reports []Report
+
+	for rows.Next() {
+		var rp Report
+		err = rows.Scan(&rp.ID, &rp.SnippetID, &rp.SnippetTitle, &rp.Reason, &rp.ReporterIP, &rp.Created)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		reports = append(reports, rp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return reports, nil
+}
+
+// Resolve marks every open report on a snippet as dealt with, whether the
+// snippet was removed or the reports dismissed.
+func (m *ReportModel) Resolve(workspaceID, snippetID int) error {
+	stmt := `UPDATE reports SET resolved = TRUE
+	WHERE workspace_id = ? AND snippet_id = ? AND resolved = FALSE`
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancel()
+
+		_, err := m.DB.ExecContext(ctx, stmt, workspaceID, snippetID)
+		return err
+	})
+	return classifyError(err)
+}
+
+// Create the reports table if it does not exist.
+func (m *ReportModel) CreateReportTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS reports (
+			id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+			workspace_id INTEGER NOT NULL,
+			snippet_id INTEGER NOT NULL,
+			reason VARCHAR(255) NOT NULL,
+			reporter_ip VARCHAR(45) NOT NULL,
+			created DATETIME NOT NULL,
+			resolved BOOLEAN NOT NULL DEFAULT FALSE,
+			INDEX idx_reports_snippet_ip (snippet_id, reporter_ip, created)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Dev seed database.
+func (m *ReportModel) SeedDatabase() error {
+	exists, err := tableExists(m.DB, "reports")
+	if err != nil || exists {
+		return err
+	}
+
+	return m.CreateReportTable()
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportModel(t *testing.T) {
+	db := newTestDB(t)
+	snippets := &SnippetModel{DB: db}
+	m := &ReportModel{DB: db}
+
+	id, err := snippets.Insert("Reported snippet", "Spam, spam, spam", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.Insert(DefaultWorkspaceID, id, "Spam", "192.0.2.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored {
+		t.Error("want the first report to be stored")
+	}
+
+	// The same IP is deduplicated within the window, another isn't.
+	stored, err = m.Insert(DefaultWorkspaceID, id, "Still spam", "192.0.2.1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored {
+		t.Error("want a repeat report from the same IP to be dropped")
+	}
+
+	stored, err = m.Insert(DefaultWorkspaceID, id, "Off-topic", "192.0.2.2", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored {
+		t.Error("want a report from another IP to be stored")
+	}
+
+	open, err := m.Open(DefaultWorkspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	for _, rp := range open {
+		if rp.SnippetID == id {
+			count++
+			if rp.SnippetTitle != "Reported snippet" {
+				t.Errorf("got title %q; want %q", rp.SnippetTitle, "Reported snippet")
+			}
+		}
+	}
+	if count != 2 {
+		t.Errorf("got %d open reports; want 2", count)
+	}
+
+	err = m.Resolve(DefaultWorkspaceID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open, err = m.Open(DefaultWorkspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rp := range open {
+		if rp.SnippetID == id {
+			t.Fatal("want resolved reports to be closed")
+		}
+	}
+}
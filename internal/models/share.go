@@ -0,0 +1,69 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A ShareLink grants read access to one snippet until Expires, without
+// needing an account in its workspace.
+type ShareLink struct {
+	WorkspaceID int
+	SnippetID   int
+	Expires     time.Time
+}
+
+// SignShareLink encodes the link as a URL safe token, signed with an
+// HMAC-SHA256 of the secret so that it can't be altered or forged.
+func SignShareLink(secret []byte, link ShareLink) string {
+	payload := fmt.Sprintf("%d:%d:%d", link.WorkspaceID, link.SnippetID, link.Expires.Unix())
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(shareSignature(secret, payload))
+}
+
+// VerifyShareLink checks a token made by SignShareLink against the secret and
+// returns the link it carries. ErrInvalidShareLink is returned for a
+// malformed or tampered token, or one which expired before now.
+func VerifyShareLink(secret []byte, token string, now time.Time) (ShareLink, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ShareLink{}, ErrInvalidShareLink
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ShareLink{}, ErrInvalidShareLink
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, shareSignature(secret, string(payload))) {
+		return ShareLink{}, ErrInvalidShareLink
+	}
+
+	var link ShareLink
+	var expires int64
+
+	_, err = fmt.Sscanf(string(payload), "%d:%d:%d", &link.WorkspaceID, &link.SnippetID, &expires)
+	if err != nil {
+		return ShareLink{}, ErrInvalidShareLink
+	}
+
+	link.Expires = time.Unix(expires, 0).UTC()
+	if !now.Before(link.Expires) {
+		return ShareLink{}, ErrInvalidShareLink
+	}
+
+	return link, nil
+}
+
+// Compute the signature of a share link payload.
+func shareSignature(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLink(t *testing.T) {
+	secret := []byte("a-share-secret-of-at-least-32-characters")
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+
+	link := ShareLink{WorkspaceID: 2, SnippetID: 7, Expires: now.Add(time.Hour)}
+	token := SignShareLink(secret, link)
+
+	// Swap the payload for another one while keeping the original signature,
+	// as someone editing a link would.
+	tamper := func(workspaceID, snippetID int, expires time.Time) string {
+		payload := fmt.Sprintf("%d:%d:%d", workspaceID, snippetID, expires.Unix())
+		_, sig, _ := strings.Cut(token, ".")
+		return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sig
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		token   string
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:   "Valid",
+			secret: secret,
+			token:  token,
+			now:    now,
+		},
+		{
+			name:    "Tampered snippet id",
+			secret:  secret,
+			token:   tamper(2, 8, link.Expires),
+			now:     now,
+			wantErr: ErrInvalidShareLink,
+		},
+		{
+			name:    "Tampered workspace",
+			secret:  secret,
+			token:   tamper(1, 7, link.Expires),
+			now:     now,
+			wantErr: ErrInvalidShareLink,
+		},
+		{
+			name:    "Tampered expiry",
+			secret:  secret,
+			token:   tamper(2, 7, link.Expires.Add(24*time.Hour)),
+			now:     now,
+			wantErr: ErrInvalidShareLink,
+		},
+		{
+			name:    "Wrong key",
+			secret:  []byte("another-secret-of-at-least-32-characters"),
+			token:   token,
+			now:     now,
+			wantErr: ErrInvalidShareLink,
+		},
+		{
+			name:    "Expired",
+			secret:  secret,
+			token:   token,
+			now:     link.Expires,
+			wantErr: ErrInvalidShareLink,
+		},
+		{
+			name:    "Malformed",
+			secret:  secret,
+			token:   "not-a-token",
+			now:     now,
+			wantErr: ErrInvalidShareLink,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyShareLink(tt.secret, tt.token, tt.now)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.WorkspaceID != link.WorkspaceID || got.SnippetID != link.SnippetID || !got.Expires.Equal(link.Expires) {
+				t.Errorf("got link %+v; want %+v", got, link)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// The longest slug stored, to fit the slug column.
+const maxSlugLength = 100
+
+// Turn a title into a lowercase, filename and URL safe slug: runs of anything
+// other than ASCII letters and digits become a single hyphen, and the result
+// is cut to fit the slug column. An empty result falls back to "snippet".
+func Slugify(title string) string {
+	var b strings.Builder
+
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+
+	slug = strings.TrimSuffix(slug, "-")
+	if slug == "" {
+		return "snippet"
+	}
+
+	return slug
+}
+
+// Add the slug column to the snippets table if it isn't there yet. New and
+// edited snippets get their slug from Insert and Update, while existing rows
+// are left with a NULL slug for BackfillSlugs to fill in.
+func (m *SnippetModel) AddSlugColumn() error {
+	return addColumn(m.DB, "snippets", "slug", "VARCHAR(100) NULL")
+}
+
+// Fill in the slug of up to limit snippets which don't have one, taking them
+// in ID order from after afterID. Every snippet is considered, whatever its
+// workspace and whether or not it's expired or deleted. It returns how many
+// rows were updated and the last ID looked at, which is the afterID for the
+// next batch; a lastID of 0 means there's nothing left to do. Rows which
+// already have a slug are never touched, so it's safe to run again.
+func (m *SnippetModel) BackfillSlugs(afterID, limit int) (updated, lastID int, err error) {
+	selectStmt := `SELECT id, title FROM snippets WHERE slug IS NULL AND id > ? ORDER BY id LIMIT ?`
+	updateStmt := `UPDATE snippets SET slug = ? WHERE id = ? AND slug IS NULL`
+
+	defer m.QueryHook.observe(m.baseContext(), selectStmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	err = m.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectStmt, afterID, limit)
+		if err != nil {
+			return err
+		}
+
+		type row struct {
+			id    int
+			title string
+		}
+		var batch []row
+
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.title); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range batch {
+			result, err := tx.ExecContext(ctx, updateStmt, Slugify(r.title), r.id)
+			if err != nil {
+				return err
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			updated += int(n)
+			lastID = r.id
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, classifyError(err)
+	}
+
+	return updated, lastID, nil
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{"Plain", "An old silent pond", "an-old-silent-pond"},
+		{"Punctuation", "  Hello, World!  ", "hello-world"},
+		{"Non-ASCII", "Café über", "caf-ber"},
+		{"Nothing left", "!!!", "snippet"},
+		{"Too long", strings.Repeat("a", 150), strings.Repeat("a", maxSlugLength)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Slugify(tt.title); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetSlugs(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	slug := func(id int) string {
+		t.Helper()
+
+		var s *string
+		err := db.QueryRow(`SELECT slug FROM snippets WHERE id = ?`, id).Scan(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	id, err := m.Insert("First title", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := slug(id); got != "first-title" {
+		t.Errorf("after Insert: got slug %q; want %q", got, "first-title")
+	}
+
+	err = m.Update(id, "Second title", "Content", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := slug(id); got != "second-title" {
+		t.Errorf("after Update: got slug %q; want %q", got, "second-title")
+	}
+}
+
+func TestBackfillSlugs(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// Four snippets from before slugs, one of them in another workspace, and
+	// one made since, which already has its slug.
+	var ids []int
+	for i, title := range []string{"One", "Two", "Three", "Four", "Five"} {
+		var sm SnippetModelInterface = m
+		if i == 2 {
+			sm = m.ForWorkspace(2)
+		}
+
+		id, err := sm.Insert(title, "Content", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	_, err := db.Exec(`UPDATE snippets SET slug = NULL WHERE id <> ?`, ids[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := []struct {
+		wantUpdated, wantLastID int
+	}{
+		{2, ids[1]},
+		{2, ids[3]},
+		{0, 0},
+	}
+
+	afterID := 0
+	for i, b := range batches {
+		updated, lastID, err := m.BackfillSlugs(afterID, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != b.wantUpdated || lastID != b.wantLastID {
+			t.Fatalf("batch %d: got %d updated and last ID %d; want %d and %d", i+1, updated, lastID, b.wantUpdated, b.wantLastID)
+		}
+		afterID = lastID
+	}
+
+	for i, want := range []string{"one", "two", "three", "four", "five"} {
+		var got string
+		err := db.QueryRow(`SELECT slug FROM snippets WHERE id = ?`, ids[i]).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("snippet %d: got slug %q; want %q", ids[i], got, want)
+		}
+	}
+}
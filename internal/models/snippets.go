@@ -1,35 +1,200 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Define a Snippet type to hold the data for an individual snippet. Notice how
 // the fields of the struct correspond to the fields in our MySQL snippets
 // table?
 type Snippet struct {
-	ID      int
+	ID       int
+	Title    string
+	Content  string
+	Created  time.Time
+	Expires  time.Time
+	Version  int
+	UserID   int
+	Archived bool
+}
+
+// A SnippetVersion is the title and content a snippet had at one version.
+type SnippetVersion struct {
+	Version int
 	Title   string
 	Content string
-	Created time.Time
-	Expires time.Time
 }
 
-// Define a SnippetModel type which wraps a sql.DB connection pool.
+// Chars returns the number of characters (runes) in the snippet content.
+func (s Snippet) Chars() int {
+	return utf8.RuneCountInString(s.Content)
+}
+
+// Lines returns the number of lines in the snippet content. A trailing
+// newline ends the last line rather than starting a new empty one, and empty
+// content has no lines at all.
+func (s Snippet) Lines() int {
+	if s.Content == "" {
+		return 0
+	}
+
+	lines := strings.Count(s.Content, "\n")
+	if !strings.HasSuffix(s.Content, "\n") {
+		lines++
+	}
+
+	return lines
+}
+
+// SnippetModelInterface describes the methods the web handlers use, so they
+// can be given a mock instead of a database-backed SnippetModel.
+type SnippetModelInterface interface {
+	Insert(title string, content string, expires int, userID int) (int, error)
+	InsertWithTags(title string, content string, expires int, userID int, tags []string) (int, error)
+	Update(id int, title string, content string, version int) error
+	Delete(id int) error
+	Restore(id int) error
+	DeleteExpired() (int, error)
+	SetArchived(id int, archived bool) error
+	ExtendExpiry(id int, days int) error
+	OwnerID(id int) (int, error)
+	CountByUser(userID int) (int, error)
+	Get(id int) (Snippet, error)
+	GetFromPrimary(id int) (Snippet, error)
+	TitleExists(title string) (bool, error)
+	ExistsMany(ids []int) (map[int]bool, error)
+	Latest(c int) ([]Snippet, error)
+	Query(f SnippetFilter) ([]Snippet, int, error)
+	Count(f SnippetFilter) (int, error)
+	After(cursor, limit int) ([]Snippet, error)
+	Versions(id int) ([]SnippetVersion, error)
+	Tags(id int) ([]string, error)
+	RenameTag(from, to string) error
+	DeleteTag(tag string) error
+	Random() (Snippet, error)
+	ToggleFavorite(userID, snippetID int) (bool, error)
+	FavoritesByUser(userID int) ([]Snippet, error)
+	ForWorkspace(workspaceID int) SnippetModelInterface
+	WithContext(ctx context.Context) SnippetModelInterface
+}
+
+// Define a SnippetModel type which wraps a sql.DB connection pool. Writes
+// always go to DB (the primary). Reads go to Replica when one is set. Every
+// query is limited to WorkspaceID, or the default workspace when it's 0, and
+// runs under the context given to WithContext, if any.
 type SnippetModel struct {
-	DB *sql.DB
+	DB          *sql.DB
+	Replica     *sql.DB
+	QueryHook   QueryHook
+	WorkspaceID int
+	ctx         context.Context
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// ForWorkspace returns a copy of the model limited to the given workspace.
+// Snippets in other workspaces behave as if they don't exist.
+func (m *SnippetModel) ForWorkspace(workspaceID int) SnippetModelInterface {
+	scoped := *m
+	scoped.WorkspaceID = workspaceID
+	return &scoped
+}
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+// WithContext returns a copy of the model whose queries run under ctx, so
+// that a request's deadline or cancellation reaches the database. Each query
+// is still limited to queryTimeout.
+func (m *SnippetModel) WithContext(ctx context.Context) SnippetModelInterface {
+	scoped := *m
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// Return the context queries are derived from.
+func (m *SnippetModel) baseContext() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// Return the workspace queries are limited to.
+func (m *SnippetModel) workspace() int {
+	if m.WorkspaceID == 0 {
+		return DefaultWorkspaceID
+	}
+	return m.WorkspaceID
+}
+
+// Return the pool reads should use, falling back to the primary when no
+// replica is configured.
+func (m *SnippetModel) reader() *sql.DB {
+	if m.Replica != nil {
+		return m.Replica
+	}
+	return m.DB
+}
+
+// Run fn in a transaction on the primary database, for writes which span
+// several statements.
+func (m *SnippetModel) withTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	return withTx(ctx, m.DB, fn)
+}
+
+// The statements behind Insert, Get and Latest, shared with
+// PreparedSnippetModel.
+const (
+	insertSnippetStmt = `INSERT INTO snippets (title, slug, content, created, expires, user_id, workspace_id)
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), NULLIF(?, 0), ?)`
+
+	getSnippetStmt = `SELECT id, title, content, created, expires, version, COALESCE(user_id, 0), archived FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ? AND workspace_id = ?`
+
+	latestSnippetsStmt = `SELECT id, title, content, created, expires, version, COALESCE(user_id, 0), archived FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND archived = FALSE AND workspace_id = ?
+    ORDER BY id DESC LIMIT ?`
+)
+
+// The number of days a snippet may be kept for. Handlers validate against
+// this for friendly error messages, and the model checks it again so that no
+// caller can get around it. The web app replaces it with EXPIRY_DAYS at
+// startup, before serving any requests.
+var PermittedExpiries = []int{1, 7, 365}
+
+// This will insert a new snippet into the database, with a slug made from the
+// title. The userID is the owner, or 0 for a snippet created anonymously.
+// ErrInvalidExpiry is returned if expires isn't one of PermittedExpiries, and
+// ErrDuplicate if the row collides with a unique key.
+func (m *SnippetModel) Insert(title string, content string, expires int, userID int) (int, error) {
+	if !slices.Contains(PermittedExpiries, expires) {
+		return 0, ErrInvalidExpiry
+	}
+
+	stmt := insertSnippetStmt
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var result sql.Result
+
+	// Writes can deadlock under concurrency, so retry those.
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		var err error
+		result, err = m.DB.ExecContext(ctx, stmt, title, Slugify(title), content, expires, userID, m.workspace())
+		return err
+	})
 	if err != nil {
-		return 0, err
+		if mySQLErrorNumber(err) == mySQLDuplicateEntry {
+			return 0, ErrDuplicate
+		}
+		return 0, classifyError(err)
 	}
 
 	// Use the LastInsertId() method on the result to get the ID of our
@@ -44,33 +209,385 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 	return int(id), nil
 }
 
-// This will return a specific snippet based on its id.
+// This will update the title (and so the slug) and content of a snippet,
+// provided the stored version still matches the version the caller last read.
+// The version is bumped on every successful update, so a stale version
+// results in no rows being matched and ErrEditConflict being returned.
+func (m *SnippetModel) Update(id int, title string, content string, version int) error {
+	// The outgoing version is copied into the history first. If the update
+	// then matches nothing the transaction is rolled back, copy and all.
+	historyStmt := `INSERT INTO snippet_versions (snippet_id, version, title, content, replaced)
+	SELECT id, version, title, content, UTC_TIMESTAMP() FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ? AND version = ? AND workspace_id = ?`
+	stmt := `UPDATE snippets SET title = ?, slug = ?, content = ?, version = version + 1
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ? AND version = ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		return m.withTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, historyStmt, id, version, m.workspace())
+			if err != nil {
+				return err
+			}
+
+			result, err := tx.ExecContext(ctx, stmt, title, Slugify(title), content, id, version, m.workspace())
+			if err != nil {
+				return err
+			}
+
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			if rows == 0 {
+				return ErrEditConflict
+			}
+
+			return nil
+		})
+	})
+	if errors.Is(err, ErrEditConflict) {
+		return err
+	}
+
+	return classifyError(err)
+}
+
+// This will permanently remove every expired snippet, soft deleted or not,
+// and return how many were removed. Their tags, versions, favorites and
+// reports are removed with them, in the same transaction.
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	dependentStmts := []string{
+		`DELETE t FROM snippet_tags t INNER JOIN snippets s ON s.id = t.snippet_id
+		WHERE s.expires <= ? AND s.workspace_id = ?`,
+		`DELETE v FROM snippet_versions v INNER JOIN snippets s ON s.id = v.snippet_id
+		WHERE s.expires <= ? AND s.workspace_id = ?`,
+		`DELETE f FROM favorites f INNER JOIN snippets s ON s.id = f.snippet_id
+		WHERE s.expires <= ? AND s.workspace_id = ?`,
+		`DELETE r FROM reports r INNER JOIN snippets s ON s.id = r.snippet_id
+		WHERE s.expires <= ? AND s.workspace_id = ?`,
+	}
+	stmt := `DELETE FROM snippets WHERE expires <= ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var rows int64
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		return m.withTx(ctx, func(tx *sql.Tx) error {
+			// Every statement uses the same cutoff, so a snippet which
+			// expires part way through is either removed along with
+			// everything referring to it or left for next time.
+			var cutoff time.Time
+			err := tx.QueryRowContext(ctx, `SELECT UTC_TIMESTAMP()`).Scan(&cutoff)
+			if err != nil {
+				return err
+			}
+
+			for _, dependentStmt := range dependentStmts {
+				_, err = tx.ExecContext(ctx, dependentStmt, cutoff, m.workspace())
+				if err != nil {
+					return err
+				}
+			}
+
+			result, err := tx.ExecContext(ctx, stmt, cutoff, m.workspace())
+			if err != nil {
+				return err
+			}
+
+			rows, err = result.RowsAffected()
+			return err
+		})
+	})
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	return int(rows), nil
+}
+
+// This will soft delete a snippet by stamping deleted_at. The row stays in
+// the table (so it can be restored) but is hidden from every other query.
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `UPDATE snippets SET deleted_at = UTC_TIMESTAMP()
+	WHERE id = ? AND deleted_at IS NULL AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var result sql.Result
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		var err error
+		result, err = m.DB.ExecContext(ctx, stmt, id, m.workspace())
+		return err
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will undo a soft delete. ErrNoRecord is returned if the snippet
+// doesn't exist or isn't deleted.
+func (m *SnippetModel) Restore(id int) error {
+	stmt := `UPDATE snippets SET deleted_at = NULL
+	WHERE id = ? AND deleted_at IS NOT NULL AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var result sql.Result
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		var err error
+		result, err = m.DB.ExecContext(ctx, stmt, id, m.workspace())
+		return err
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will archive (or unarchive) a snippet. Archived snippets are left out
+// of listings but can still be viewed directly.
+func (m *SnippetModel) SetArchived(id int, archived bool) error {
+	stmt := `UPDATE snippets SET archived = ?
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		_, err := m.DB.ExecContext(ctx, stmt, archived, id, m.workspace())
+		return err
+	})
+
+	return classifyError(err)
+}
+
+// This will push a snippet's expiry back by the given number of days,
+// counting from now if it has already expired. Expired snippets which
+// haven't been purged yet can be brought back this way.
+func (m *SnippetModel) ExtendExpiry(id int, days int) error {
+	if !slices.Contains(PermittedExpiries, days) {
+		return ErrInvalidExpiry
+	}
+
+	stmt := `UPDATE snippets SET expires = DATE_ADD(GREATEST(expires, UTC_TIMESTAMP()), INTERVAL ? DAY)
+	WHERE deleted_at IS NULL AND id = ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var result sql.Result
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		var err error
+		result, err = m.DB.ExecContext(ctx, stmt, days, id, m.workspace())
+		return err
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// OwnerID returns the id of the user who owns a snippet (0 if it was created
+// anonymously). Unlike Get it includes expired snippets, so ownership can be
+// checked before extending one.
+func (m *SnippetModel) OwnerID(id int) (int, error) {
+	var userID int
+
+	stmt := `SELECT COALESCE(user_id, 0) FROM snippets
+	WHERE deleted_at IS NULL AND id = ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	err := m.reader().QueryRowContext(ctx, stmt, id, m.workspace()).Scan(&userID)
+	return userID, classifyError(err)
+}
+
+// This will return a specific snippet based on its id. Archived snippets are
+// included, so direct links keep working.
 func (m *SnippetModel) Get(id int) (Snippet, error) {
+	return m.get(m.reader(), id)
+}
+
+// GetFromPrimary works like Get, but always reads from the primary. Use it
+// where a replica lagging behind would do harm, e.g. to load a snippet for
+// editing or straight after writing it.
+func (m *SnippetModel) GetFromPrimary(id int) (Snippet, error) {
+	return m.get(m.DB, id)
+}
+
+func (m *SnippetModel) get(db *sql.DB, id int) (Snippet, error) {
 	var s Snippet
 
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := getSnippetStmt
 
-	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	// Missing rows and timeouts are mapped to ErrNoRecord and ErrTimeout, so
+	// the handler can tell them apart from genuine database failures.
+	err := db.QueryRowContext(ctx, stmt, id, m.workspace()).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Version, &s.UserID, &s.Archived)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Snippet{}, ErrNoRecord
-		} else {
-			return Snippet{}, err
-		}
+		return Snippet{}, classifyError(err)
 	}
 
 	return s, nil
 }
 
+// TitleExists reports whether a live snippet already has the given title,
+// ignoring case and surrounding whitespace.
+func (m *SnippetModel) TitleExists(title string) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND LOWER(TRIM(title)) = LOWER(TRIM(?)) AND workspace_id = ?)`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	err := m.reader().QueryRowContext(ctx, stmt, title, m.workspace()).Scan(&exists)
+	return exists, classifyError(err)
+}
+
+// CountByUser returns how many live snippets (archived ones included) a user
+// owns in the workspace.
+func (m *SnippetModel) CountByUser(userID int) (int, error) {
+	var count int
+
+	stmt := `SELECT COUNT(*) FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND user_id = ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	err := m.reader().QueryRowContext(ctx, stmt, userID, m.workspace()).Scan(&count)
+	return count, classifyError(err)
+}
+
+// ExistsMany reports, for each of the given ids, whether it belongs to a live
+// snippet. Every id appears in the result, duplicates only once.
+func (m *SnippetModel) ExistsMany(ids []int) (map[int]bool, error) {
+	exists := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		exists[id] = false
+	}
+
+	if len(exists) == 0 {
+		return exists, nil
+	}
+
+	// One placeholder per distinct id.
+	args := []any{m.workspace()}
+	for id := range exists {
+		args = append(args, id)
+	}
+
+	stmt := `SELECT id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND workspace_id = ?
+	AND id IN (?` + strings.Repeat(", ?", len(exists)-1) + `)`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.reader().QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		exists[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return exists, nil
+}
+
 // This will return the # most recently created snippets.
 func (m *SnippetModel) Latest(c int) ([]Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT ?`
+	stmt := latestSnippetsStmt
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
 
-	rows, err := m.DB.Query(stmt, c)
+	rows, err := m.reader().QueryContext(ctx, stmt, m.workspace(), c)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	// Ensure close.
@@ -86,9 +603,9 @@ func (m *SnippetModel) Latest(c int) ([]Snippet, error) {
 		// must be pointers to the place you want to copy the data into, and the
 		// number of arguments must be exactly the same as the number of
 		// columns returned by your statement.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Version, &s.UserID, &s.Archived)
 		if err != nil {
-			return nil, err
+			return nil, classifyError(err)
 		}
 		// Append it to the slice of snippets.
 		snippets = append(snippets, s)
@@ -99,7 +616,372 @@ func (m *SnippetModel) Latest(c int) ([]Snippet, error) {
 	// call this - don't assume that a successful iteration was completed
 	// over the whole resultset.
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, classifyError(err)
+	}
+
+	return snippets, nil
+}
+
+// The sort keys accepted by Query, mapped to the ORDER BY clause each one uses.
+// Only these fixed strings ever reach the SQL, never the caller's input.
+var snippetSortClauses = map[string]string{
+	"newest": "id DESC",
+	"oldest": "id ASC",
+	"title":  "title ASC, id DESC",
+}
+
+// SnippetSorts lists the sort keys accepted by Query.
+var SnippetSorts = []string{"newest", "oldest", "title"}
+
+// A SnippetFilter describes a page of unarchived snippets for Query. Fields
+// left at their zero value don't narrow the results, so a Limit of 0 returns
+// every match from Offset on.
+type SnippetFilter struct {
+	Limit          int
+	Offset         int
+	Sort           string // One of SnippetSorts, "newest" when empty.
+	Search         string // Only titles or content containing this, case-insensitively.
+	Tag            string // Only snippets with this tag.
+	OwnerID        int    // Only snippets created by this user.
+	IncludeExpired bool   // Include snippets past their expiry date.
+}
+
+// Escape the LIKE wildcards in s, so that it only matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Build the WHERE clause and its arguments for a filter. Only fixed SQL
+// fragments are ever joined together, the filter values are always passed
+// as arguments.
+func (m *SnippetModel) filterWhere(f SnippetFilter) (string, []any) {
+	conditions := []string{"deleted_at IS NULL", "archived = FALSE", "workspace_id = ?"}
+	args := []any{m.workspace()}
+
+	if !f.IncludeExpired {
+		conditions = append(conditions, "expires > UTC_TIMESTAMP()")
+	}
+	if f.Search != "" {
+		pattern := "%" + escapeLike(f.Search) + "%"
+		conditions = append(conditions, "(title LIKE ? OR content LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT true FROM snippet_tags t WHERE t.snippet_id = snippets.id AND t.tag = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.OwnerID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, f.OwnerID)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Query returns a page of unarchived snippets matching the filter, along
+// with the total number of matches across all pages. ErrInvalidSort is
+// returned for a sort key not in SnippetSorts.
+func (m *SnippetModel) Query(f SnippetFilter) ([]Snippet, int, error) {
+	if f.Sort == "" {
+		f.Sort = "newest"
+	}
+	orderBy, ok := snippetSortClauses[f.Sort]
+	if !ok {
+		return nil, 0, ErrInvalidSort
+	}
+
+	where, args := m.filterWhere(f)
+
+	// MySQL has no OFFSET without a LIMIT, so no limit is a huge one.
+	limit := int64(f.Limit)
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+
+	countStmt := `SELECT COUNT(*) FROM snippets WHERE ` + where
+	stmt := `SELECT id, title, content, created, expires, version, COALESCE(user_id, 0), archived FROM snippets
+    WHERE ` + where + `
+    ORDER BY ` + orderBy + ` LIMIT ? OFFSET ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	var total int
+
+	err := m.reader().QueryRowContext(ctx, countStmt, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, classifyError(err)
+	}
+
+	rows, err := m.reader().QueryContext(ctx, stmt, append(args, limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Version, &s.UserID, &s.Archived)
+		if err != nil {
+			return nil, 0, classifyError(err)
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, classifyError(err)
+	}
+
+	return snippets, total, nil
+}
+
+// Count returns how many unarchived snippets match the filter, as the total
+// from Query would, without fetching any of them. Sort, Limit and Offset are
+// ignored.
+func (m *SnippetModel) Count(f SnippetFilter) (int, error) {
+	var count int
+
+	where, args := m.filterWhere(f)
+
+	stmt := `SELECT COUNT(*) FROM snippets WHERE ` + where
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	err := m.reader().QueryRowContext(ctx, stmt, args...).Scan(&count)
+	return count, classifyError(err)
+}
+
+// This will return up to limit live, unarchived snippets with ids below
+// cursor, newest first, for keyset pagination. A cursor of 0 starts from the
+// newest snippet. Pass the last id of one page as the cursor for the next.
+func (m *SnippetModel) After(cursor, limit int) ([]Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, version, COALESCE(user_id, 0), archived FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND archived = FALSE AND workspace_id = ? AND (? = 0 OR id < ?)
+    ORDER BY id DESC LIMIT ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.reader().QueryContext(ctx, stmt, m.workspace(), cursor, cursor, limit)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Version, &s.UserID, &s.Archived)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return snippets, nil
+}
+
+// Versions returns every version of a live snippet, oldest first, ending
+// with the current one. ErrNoRecord is returned if there's no such snippet.
+func (m *SnippetModel) Versions(id int) ([]SnippetVersion, error) {
+	stmt := `SELECT v.version, v.title, v.content FROM snippet_versions v
+	INNER JOIN snippets s ON s.id = v.snippet_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.deleted_at IS NULL AND s.id = ? AND s.workspace_id = ?
+	UNION ALL
+	SELECT version, title, content FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ? AND workspace_id = ?
+	ORDER BY version ASC`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.reader().QueryContext(ctx, stmt, id, m.workspace(), id, m.workspace())
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var versions []SnippetVersion
+
+	for rows.Next() {
+		var v SnippetVersion
+		err = rows.Scan(&v.Version, &v.Title, &v.Content)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		versions = append(versions, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	// The current version is always there for a live snippet.
+	if len(versions) == 0 {
+		return nil, ErrNoRecord
+	}
+
+	return versions, nil
+}
+
+// Random returns a live, unarchived snippet picked at random, or ErrNoRecord
+// if there are none. Rather than ORDER BY RAND(), which sorts the whole
+// table, it picks a random id within the range of live ids and takes the
+// first snippet from there on. Snippets after a gap in the ids are picked
+// a little more often, which is fine for discovery.
+func (m *SnippetModel) Random() (Snippet, error) {
+	rangeStmt := `SELECT MIN(id), MAX(id) FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND archived = FALSE AND workspace_id = ?`
+	stmt := `SELECT id, title, content, created, expires, version, COALESCE(user_id, 0), archived FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND archived = FALSE AND workspace_id = ? AND id >= ?
+	ORDER BY id ASC LIMIT 1`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	// Both are NULL when there are no live snippets.
+	var minID, maxID sql.NullInt64
+
+	err := m.reader().QueryRowContext(ctx, rangeStmt, m.workspace()).Scan(&minID, &maxID)
+	if err != nil {
+		return Snippet{}, classifyError(err)
+	}
+	if !minID.Valid {
+		return Snippet{}, ErrNoRecord
+	}
+
+	threshold := minID.Int64 + rand.Int63n(maxID.Int64-minID.Int64+1)
+
+	var s Snippet
+
+	err = m.reader().QueryRowContext(ctx, stmt, m.workspace(), threshold).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Version, &s.UserID, &s.Archived)
+	if err != nil {
+		return Snippet{}, classifyError(err)
+	}
+
+	return s, nil
+}
+
+// ToggleFavorite adds a live snippet to a user's favorites, or removes it if
+// it's already there, and returns whether it is now a favorite.
+// ErrNoRecord is returned when adding a snippet which doesn't exist.
+func (m *SnippetModel) ToggleFavorite(userID, snippetID int) (bool, error) {
+	deleteStmt := `DELETE f FROM favorites f INNER JOIN snippets s ON s.id = f.snippet_id
+	WHERE f.user_id = ? AND f.snippet_id = ? AND s.workspace_id = ?`
+	insertStmt := `INSERT INTO favorites (user_id, snippet_id, created)
+	SELECT ?, id, UTC_TIMESTAMP() FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND deleted_at IS NULL AND id = ? AND workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), deleteStmt)()
+
+	var favorite bool
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		return m.withTx(ctx, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(ctx, deleteStmt, userID, snippetID, m.workspace())
+			if err != nil {
+				return err
+			}
+
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rows > 0 {
+				favorite = false
+				return nil
+			}
+
+			result, err = tx.ExecContext(ctx, insertStmt, userID, snippetID, m.workspace())
+			if err != nil {
+				// A concurrent request got there first, the outcome is the
+				// same.
+				if isDuplicateKey(err, "PRIMARY") {
+					favorite = true
+					return nil
+				}
+				return err
+			}
+
+			rows, err = result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rows == 0 {
+				return ErrNoRecord
+			}
+
+			favorite = true
+			return nil
+		})
+	})
+	if errors.Is(err, ErrNoRecord) {
+		return false, err
+	}
+	if err != nil {
+		return false, classifyError(err)
+	}
+
+	return favorite, nil
+}
+
+// FavoritesByUser returns the live snippets a user has favorited, most
+// recently favorited first.
+func (m *SnippetModel) FavoritesByUser(userID int) ([]Snippet, error) {
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, s.version, COALESCE(s.user_id, 0), s.archived
+	FROM favorites f INNER JOIN snippets s ON s.id = f.snippet_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.deleted_at IS NULL AND f.user_id = ? AND s.workspace_id = ?
+	ORDER BY f.created DESC, s.id DESC`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.reader().QueryContext(ctx, stmt, userID, m.workspace())
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Version, &s.UserID, &s.Archived)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
 	}
 
 	return snippets, nil
@@ -111,9 +993,97 @@ func (m *SnippetModel) CreateSnippetTable() error {
 		CREATE TABLE IF NOT EXISTS snippets (
 			id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
 			title VARCHAR(100) NOT NULL,
+			slug VARCHAR(100) NULL,
 			content TEXT NOT NULL,
 			created DATETIME NOT NULL,
-			expires DATETIME NOT NULL
+			expires DATETIME NOT NULL,
+			version INTEGER NOT NULL DEFAULT 1,
+			deleted_at DATETIME NULL,
+			user_id INTEGER NULL,
+			archived BOOLEAN NOT NULL DEFAULT FALSE,
+			workspace_id INTEGER NOT NULL DEFAULT 1
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Add the columns introduced since the snippets table was first created to
+// an older copy of it. Existing rows get the same defaults as new ones: the
+// first version, not deleted, no owner and not archived. Their slugs are left
+// NULL for BackfillSlugs to fill in.
+func (m *SnippetModel) AddMissingColumns() error {
+	columns := []struct{ name, definition string }{
+		{"version", "INTEGER NOT NULL DEFAULT 1"},
+		{"deleted_at", "DATETIME NULL"},
+		{"user_id", "INTEGER NULL"},
+		{"archived", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"slug", "VARCHAR(100) NULL"},
+	}
+
+	for _, c := range columns {
+		if err := addColumn(m.DB, "snippets", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The most content, in bytes, each column type can hold.
+const (
+	TextColumnBytes       = 65535
+	MediumTextColumnBytes = 16777215
+)
+
+// Switch the content column to MEDIUMTEXT, for deployments which allow
+// snippets larger than a TEXT column can hold. It does nothing if the column
+// has already been changed.
+func (m *SnippetModel) UseMediumText() error {
+	stmt := `SELECT DATA_TYPE FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = 'snippets' AND column_name = 'content'`
+
+	var dataType string
+	err := m.DB.QueryRow(stmt).Scan(&dataType)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(dataType, "mediumtext") {
+		return nil
+	}
+
+	_, err = m.DB.Exec(`ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL`)
+	return err
+}
+
+// Create the snippet_versions table if it does not exist. It holds each
+// version of a snippet which has since been replaced by an edit.
+func (m *SnippetModel) CreateVersionTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS snippet_versions (
+			snippet_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			title VARCHAR(100) NOT NULL,
+			content MEDIUMTEXT NOT NULL,
+			replaced DATETIME NOT NULL,
+			PRIMARY KEY (snippet_id, version)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Create the favorites table if it does not exist. The composite primary key
+// stops a user favoriting the same snippet twice.
+func (m *SnippetModel) CreateFavoriteTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS favorites (
+			user_id INTEGER NOT NULL,
+			snippet_id INTEGER NOT NULL,
+			created DATETIME NOT NULL,
+			PRIMARY KEY (user_id, snippet_id),
+			INDEX idx_favorites_snippet (snippet_id)
 		)
 	`
 	_, err := m.DB.Exec(stmt)
@@ -149,30 +1119,66 @@ func (m *SnippetModel) CreateSessionIndex() error {
 
 // Dev seed database.
 func (m *SnippetModel) SeedDatabase() error {
-	// Check if tables exist, if so return.
-	stmt := `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name IN ('snippets', 'sessions')`
-	var count int
-	err := m.DB.QueryRow(stmt).Scan(&count)
+	// Set up each table (and its index) only if it doesn't exist yet.
+	exists, err := tableExists(m.DB, "snippets")
 	if err != nil {
 		return err
 	}
+	if !exists {
+		if err := m.CreateSnippetTable(); err != nil {
+			return err
+		}
+		if err := m.CreateSnippetIndex(); err != nil {
+			return err
+		}
+	}
 
-	if count > 0 {
-		return nil
+	if err := m.AddMissingColumns(); err != nil {
+		return err
 	}
 
-	// Setup tables and indexes.
-	if err := m.CreateSnippetTable(); err != nil {
+	exists, err = tableExists(m.DB, "snippet_versions")
+	if err != nil {
 		return err
 	}
-	if err := m.CreateSnippetIndex(); err != nil {
+	if !exists {
+		if err := m.CreateVersionTable(); err != nil {
+			return err
+		}
+	}
+
+	exists, err = tableExists(m.DB, "favorites")
+	if err != nil {
 		return err
 	}
-	if err := m.CreateSessionTable(); err != nil {
+	if !exists {
+		if err := m.CreateFavoriteTable(); err != nil {
+			return err
+		}
+	}
+
+	exists, err = tableExists(m.DB, "snippet_tags")
+	if err != nil {
 		return err
 	}
-	if err := m.CreateSessionIndex(); err != nil {
+	if !exists {
+		if err := m.CreateTagTable(); err != nil {
+			return err
+		}
+	}
+
+	exists, err = tableExists(m.DB, "sessions")
+	if err != nil {
 		return err
 	}
+	if !exists {
+		if err := m.CreateSessionTable(); err != nil {
+			return err
+		}
+		if err := m.CreateSessionIndex(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,914 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnippetWorkspaceIsolation(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t), WorkspaceID: 1}
+	other := m.ForWorkspace(2)
+
+	id, err := m.Insert("Workspace one", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = other.Get(id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Get: got error %v; want %v", err, ErrNoRecord)
+	}
+
+	_, err = other.OwnerID(id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("OwnerID: got error %v; want %v", err, ErrNoRecord)
+	}
+
+	err = other.Update(id, "Taken over", "Content", 1)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Update: got error %v; want %v", err, ErrEditConflict)
+	}
+
+	err = other.Delete(id)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Delete: got error %v; want %v", err, ErrNoRecord)
+	}
+
+	// The snippet is untouched in its own workspace.
+	s, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Workspace one" || s.Version != 1 {
+		t.Errorf("got title %q version %d; want %q version 1", s.Title, s.Version, "Workspace one")
+	}
+}
+
+func TestSnippetUpdate(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	id, err := m.Insert("First draft", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Update(id, "Second draft", "More content", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Second draft" || s.Version != 2 {
+		t.Errorf("got title %q version %d; want %q version 2", s.Title, s.Version, "Second draft")
+	}
+
+	// A second editor still holding version 1 loses.
+	err = m.Update(id, "Stale draft", "Old content", 1)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got error %v; want %v", err, ErrEditConflict)
+	}
+
+	s, err = m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Second draft" || s.Version != 2 {
+		t.Errorf("after the conflict got title %q version %d; want %q version 2", s.Title, s.Version, "Second draft")
+	}
+}
+
+func TestSnippetModelWithContext(t *testing.T) {
+	db := sql.OpenDB(&txCounter{})
+	defer db.Close()
+
+	m := &SnippetModel{DB: db}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The cancelled context stops the query before it reaches the driver.
+	_, err := m.WithContext(ctx).Get(1)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("with a cancelled context got error %v; want %v", err, ErrTimeout)
+	}
+
+	// The model it was derived from is unaffected, and gets as far as the
+	// driver (which can't run queries).
+	_, err = m.Get(1)
+	if err == nil || errors.Is(err, ErrTimeout) {
+		t.Errorf("without a context got error %v; want a driver error", err)
+	}
+}
+
+func TestSnippetStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantChars int
+		wantLines int
+	}{
+		{"Empty", "", 0, 0},
+		{"Single line", "An old silent pond", 18, 1},
+		{"Trailing newline", "An old silent pond\n", 19, 1},
+		{"Several lines", "An old silent pond\nA frog jumps into the pond,\nsplash!", 54, 3},
+		{"Blank line", "one\n\nthree\n", 11, 3},
+		{"Multi-byte", "古池や\n蛙飛び込む", 9, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Snippet{Content: tt.content}
+
+			if got := s.Chars(); got != tt.wantChars {
+				t.Errorf("got %d chars; want %d", got, tt.wantChars)
+			}
+			if got := s.Lines(); got != tt.wantLines {
+				t.Errorf("got %d lines; want %d", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestTitleExists(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	_, err := m.Insert("An old silent pond", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{"An old silent pond", true},
+		{"AN OLD SILENT POND", true},
+		{"  an old silent pond ", true},
+		{"An old silent", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			got, err := m.TitleExists(tt.title)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetModelReplica(t *testing.T) {
+	errPrimary := errors.New("primary")
+	errReplica := errors.New("replica")
+
+	primary := sql.OpenDB(failingPool{errPrimary})
+	defer primary.Close()
+	replica := sql.OpenDB(failingPool{errReplica})
+	defer replica.Close()
+
+	tests := []struct {
+		name     string
+		replica  *sql.DB
+		query    func(m *SnippetModel) error
+		wantPool error
+	}{
+		{
+			name:     "Get",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { _, err := m.Get(1); return err },
+			wantPool: errReplica,
+		},
+		{
+			name:     "Latest",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { _, err := m.Latest(10); return err },
+			wantPool: errReplica,
+		},
+		{
+			name:     "Query",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { _, _, err := m.Query(SnippetFilter{Search: "pond"}); return err },
+			wantPool: errReplica,
+		},
+		{
+			name:     "GetFromPrimary",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { _, err := m.GetFromPrimary(1); return err },
+			wantPool: errPrimary,
+		},
+		{
+			name:     "Insert",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { _, err := m.Insert("Title", "Content", 7, 0); return err },
+			wantPool: errPrimary,
+		},
+		{
+			name:     "Update",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { return m.Update(1, "Title", "Content", 1) },
+			wantPool: errPrimary,
+		},
+		{
+			name:     "Delete",
+			replica:  replica,
+			query:    func(m *SnippetModel) error { return m.Delete(1) },
+			wantPool: errPrimary,
+		},
+		{
+			name:     "Get without a replica",
+			query:    func(m *SnippetModel) error { _, err := m.Get(1); return err },
+			wantPool: errPrimary,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &SnippetModel{DB: primary, Replica: tt.replica}
+
+			err := tt.query(m)
+			if !errors.Is(err, tt.wantPool) {
+				t.Errorf("got error %v; want it from the %v pool", err, tt.wantPool)
+			}
+		})
+	}
+}
+
+func TestSnippetArchive(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	id, err := m.Insert("Archived snippet", "Hidden from listings", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.SetArchived(id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := func() bool {
+		t.Helper()
+
+		latest, err := m.Latest(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, _, err := m.Query(SnippetFilter{Search: "Hidden from listings", Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range append(latest, found...) {
+			if s.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	if listed() {
+		t.Error("archived snippet is listed")
+	}
+
+	s, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Archived {
+		t.Error("got Archived false; want true")
+	}
+
+	err = m.SetArchived(id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !listed() {
+		t.Error("unarchived snippet is not listed")
+	}
+}
+
+func TestSnippetQuerySort(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	var ids []int
+	for _, title := range []string{"Banana", "Apple", "Cherry"} {
+		id, err := m.Insert(title, "Sorted fruit", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	banana, apple, cherry := ids[0], ids[1], ids[2]
+
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{sort: "", want: []int{cherry, apple, banana}},
+		{sort: "newest", want: []int{cherry, apple, banana}},
+		{sort: "oldest", want: []int{banana, apple, cherry}},
+		{sort: "title", want: []int{apple, banana, cherry}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			snippets, _, err := m.Query(SnippetFilter{Sort: tt.sort, Search: "Sorted fruit", Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int
+			for _, s := range snippets {
+				got = append(got, s.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v; want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, sort := range []string{"NEWEST", "id; DROP TABLE snippets", "title ASC, (SELECT SLEEP(5))"} {
+		_, _, err := m.Query(SnippetFilter{Sort: sort, Limit: 10})
+		if !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("sort %q: got error %v; want %v", sort, err, ErrInvalidSort)
+		}
+	}
+}
+
+func TestSnippetDeleteExpired(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	reports := &ReportModel{DB: db}
+
+	// Give a snippet a row in every table which refers to snippets.
+	addDependents := func(title string) int {
+		t.Helper()
+
+		id, err := m.InsertWithTags(title, "Content", 7, 1, []string{"go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.Update(id, title, "Edited content", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = m.ToggleFavorite(1, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = reports.Insert(DefaultWorkspaceID, id, "spam", "192.0.2.1", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	expired := addDependents("Expired")
+	live := addDependents("Live")
+
+	_, err := db.Exec(`UPDATE snippets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY) WHERE id = ?`, expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := m.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("got %d deleted; want 1", deleted)
+	}
+
+	for _, table := range []string{"snippets", "snippet_tags", "snippet_versions", "favorites", "reports"} {
+		column := "snippet_id"
+		if table == "snippets" {
+			column = "id"
+		}
+
+		for id, want := range map[int]int{expired: 0, live: 1} {
+			var count int
+			err = db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+column+" = ?", id).Scan(&count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != want {
+				t.Errorf("%s: got %d rows for snippet %d; want %d", table, count, id, want)
+			}
+		}
+	}
+}
+
+func TestSnippetExtendExpiry(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	// Minutes from now until the snippet expires.
+	expiresIn := func(id int) int {
+		t.Helper()
+
+		var minutes int
+		err := db.QueryRow(`SELECT TIMESTAMPDIFF(MINUTE, UTC_TIMESTAMP(), expires) FROM snippets WHERE id = ?`, id).Scan(&minutes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return minutes
+	}
+
+	active, err := m.Insert("Active", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := m.Insert("Just expired", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`UPDATE snippets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE) WHERE id = ?`, expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+		days int
+		want int
+	}{
+		// Added on to the current expiry.
+		{name: "Active", id: active, days: 7, want: 14 * 24 * 60},
+		// Counted from now, not from the past expiry.
+		{name: "Just expired", id: expired, days: 1, want: 24 * 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.ExtendExpiry(tt.id, tt.days)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := expiresIn(tt.id); got < tt.want-1 || got > tt.want {
+				t.Errorf("got expiry in %d minutes; want %d", got, tt.want)
+			}
+		})
+	}
+
+	// The extended snippet is live again.
+	_, err = m.Get(expired)
+	if err != nil {
+		t.Errorf("Get after extending: got error %v; want nil", err)
+	}
+
+	err = m.ExtendExpiry(999, 7)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("missing snippet: got error %v; want %v", err, ErrNoRecord)
+	}
+}
+
+func TestSnippetExtendExpiryInvalidDays(t *testing.T) {
+	// Rejected before the database is touched.
+	m := &SnippetModel{}
+
+	for _, days := range []int{0, -1, 9999} {
+		err := m.ExtendExpiry(1, days)
+		if !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("%d days: got error %v; want %v", days, err, ErrInvalidExpiry)
+		}
+	}
+}
+
+func TestSnippetExtendExpiryConfiguredDays(t *testing.T) {
+	permitted := PermittedExpiries
+	PermittedExpiries = []int{3, 30}
+	t.Cleanup(func() { PermittedExpiries = permitted })
+
+	m := &SnippetModel{}
+
+	for _, days := range []int{1, 7, 365} {
+		err := m.ExtendExpiry(1, days)
+		if !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("%d days: got error %v; want %v", days, err, ErrInvalidExpiry)
+		}
+	}
+}
+
+func TestInsertInvalidExpiry(t *testing.T) {
+	db := sql.OpenDB(failingPool{errors.New("unreachable")})
+	defer db.Close()
+
+	m := &SnippetModel{DB: db}
+	prepared := &PreparedSnippetModel{SnippetModel: m}
+
+	inserts := map[string]func(expires int) error{
+		"Insert": func(expires int) error {
+			_, err := m.Insert("A title", "Content", expires, 0)
+			return err
+		},
+		"InsertWithTags": func(expires int) error {
+			_, err := m.InsertWithTags("A title", "Content", expires, 0, []string{"go"})
+			return err
+		},
+		"Prepared Insert": func(expires int) error {
+			_, err := prepared.Insert("A title", "Content", expires, 0)
+			return err
+		},
+	}
+
+	for name, insert := range inserts {
+		t.Run(name, func(t *testing.T) {
+			for _, expires := range []int{0, -1, 9999} {
+				err := insert(expires)
+				if !errors.Is(err, ErrInvalidExpiry) {
+					t.Errorf("expires %d: got error %v; want %v", expires, err, ErrInvalidExpiry)
+				}
+			}
+
+			// A permitted value gets as far as the database. The prepared
+			// model has no statements to run without one.
+			if name == "Prepared Insert" {
+				return
+			}
+			err := insert(7)
+			if errors.Is(err, ErrInvalidExpiry) {
+				t.Errorf("expires 7: got error %v; want it to reach the database", err)
+			}
+		})
+	}
+}
+
+func TestSnippetExistsMany(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	live, err := m.Insert("Live snippet", "Still here", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := m.Insert("Expired snippet", "Gone", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.DB.Exec("UPDATE snippets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY) WHERE id = ?", expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := expired + 1000
+
+	exists, err := m.ExistsMany([]int{live, expired, missing, live})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]bool{live: true, expired: false, missing: false}
+	if len(exists) != len(want) {
+		t.Errorf("got %v; want %v", exists, want)
+	}
+	for id, w := range want {
+		if exists[id] != w {
+			t.Errorf("id %d: got %t; want %t", id, exists[id], w)
+		}
+	}
+
+	exists, err = m.ExistsMany(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exists) != 0 {
+		t.Errorf("got %v; want an empty map", exists)
+	}
+}
+
+func TestSnippetToggleFavorite(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	id, err := m.Insert("Favorite snippet", "Worth keeping", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	favorited := func(userID int) bool {
+		t.Helper()
+
+		snippets, err := m.FavoritesByUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range snippets {
+			if s.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, want := range []bool{true, false, true} {
+		got, err := m.ToggleFavorite(1, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got state %t; want %t", got, want)
+		}
+		if favorited(1) != want {
+			t.Errorf("got listed %t; want %t", favorited(1), want)
+		}
+	}
+
+	// Another user's favorites are their own.
+	if favorited(2) {
+		t.Error("snippet listed in another user's favorites")
+	}
+
+	_, err = m.ToggleFavorite(1, id+1000)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v for a missing snippet; want %v", err, ErrNoRecord)
+	}
+}
+
+func TestSnippetAfter(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	// Start from an empty table, so only these snippets are listed.
+	_, err := m.DB.Exec("DELETE FROM snippets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []int
+	for i := 0; i < 5; i++ {
+		id, err := m.Insert(fmt.Sprintf("Snippet %d", i), "Paged", 7, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append([]int{id}, want...)
+	}
+
+	var got []int
+	cursor := 0
+	for {
+		page, err := m.After(cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, s := range page {
+			got = append(got, s.ID)
+		}
+		cursor = page[len(page)-1].ID
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got ids %v; want %v", got, want)
+	}
+}
+
+func TestSnippetVersions(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	id, err := m.Insert("First draft", "Content", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Update(id, "Second draft", "More content", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A conflicting update leaves no trace in the history.
+	err = m.Update(id, "Stale draft", "Old content", 1)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got error %v; want %v", err, ErrEditConflict)
+	}
+
+	versions, err := m.Versions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SnippetVersion{
+		{Version: 1, Title: "First draft", Content: "Content"},
+		{Version: 2, Title: "Second draft", Content: "More content"},
+	}
+	if !slices.Equal(versions, want) {
+		t.Errorf("got versions %v; want %v", versions, want)
+	}
+
+	_, err = m.Versions(id + 1000)
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v for a missing snippet; want %v", err, ErrNoRecord)
+	}
+}
+
+func TestSnippetRandom(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	_, err := m.DB.Exec("DELETE FROM snippets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Random()
+	if !errors.Is(err, ErrNoRecord) {
+		t.Fatalf("with no snippets got error %v; want %v", err, ErrNoRecord)
+	}
+
+	live, err := m.Insert("Live", "Pick me", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired, deleted and archived snippets are never picked.
+	for _, stmt := range []string{
+		"UPDATE snippets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY) WHERE id = ?",
+		"UPDATE snippets SET deleted_at = UTC_TIMESTAMP() WHERE id = ?",
+		"UPDATE snippets SET archived = TRUE WHERE id = ?",
+	} {
+		for i := 0; i < 2; i++ {
+			id, err := m.Insert("Hidden", "Don't pick me", 7, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = m.DB.Exec(stmt, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		s, err := m.Random()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.ID != live {
+			t.Fatalf("got snippet %d; want the live snippet %d", s.ID, live)
+		}
+		if !s.Expires.After(time.Now()) {
+			t.Errorf("got an expired snippet, expiring %s", s.Expires)
+		}
+	}
+}
+
+func TestSnippetFilterWhere(t *testing.T) {
+	m := &SnippetModel{WorkspaceID: 3}
+
+	const base = "deleted_at IS NULL AND archived = FALSE AND workspace_id = ?"
+	const notExpired = " AND expires > UTC_TIMESTAMP()"
+	const tagged = " AND EXISTS (SELECT true FROM snippet_tags t WHERE t.snippet_id = snippets.id AND t.tag = ?)"
+
+	tests := []struct {
+		name      string
+		filter    SnippetFilter
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "Empty",
+			filter:    SnippetFilter{},
+			wantWhere: base + notExpired,
+			wantArgs:  []any{3},
+		},
+		{
+			name:      "Including expired",
+			filter:    SnippetFilter{IncludeExpired: true},
+			wantWhere: base,
+			wantArgs:  []any{3},
+		},
+		{
+			name:      "Everything",
+			filter:    SnippetFilter{Search: "pond", Tag: "haiku", OwnerID: 7},
+			wantWhere: base + notExpired + " AND (title LIKE ? OR content LIKE ?)" + tagged + " AND user_id = ?",
+			wantArgs:  []any{3, "%pond%", "%pond%", "haiku", 7},
+		},
+		{
+			name:      "Search wildcards",
+			filter:    SnippetFilter{Search: `100%_\`},
+			wantWhere: base + notExpired + " AND (title LIKE ? OR content LIKE ?)",
+			wantArgs:  []any{3, `%100\%\_\\%`, `%100\%\_\\%`},
+		},
+		{
+			name:      "Injection attempts",
+			filter:    SnippetFilter{Search: "' OR 1=1 --", Tag: "x'); DROP TABLE snippets; --"},
+			wantWhere: base + notExpired + " AND (title LIKE ? OR content LIKE ?)" + tagged,
+			wantArgs:  []any{3, "%' OR 1=1 --%", "%' OR 1=1 --%", "x'); DROP TABLE snippets; --"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := m.filterWhere(tt.filter)
+
+			// The values only ever travel as arguments.
+			if where != tt.wantWhere {
+				t.Errorf("got where %q; want %q", where, tt.wantWhere)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("got args %v; want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSnippetQueryFilters(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	_, err := m.DB.Exec("DELETE FROM snippets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(title, content string, userID int, tags ...string) int {
+		t.Helper()
+
+		id, err := m.InsertWithTags(title, content, 7, userID, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	pond := insert("Pond", "An old silent pond", 1, "haiku", "nature")
+	frog := insert("Frog", "A frog jumps into the pond", 2, "haiku")
+	percent := insert("Discount", "100% off", 1)
+	quote := insert("Quote", "It's a ' OR 1=1 -- trap", 2, "sql")
+	expired := insert("Old pond", "A pond long gone", 1, "haiku")
+
+	_, err = m.DB.Exec("UPDATE snippets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY) WHERE id = ?", expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    SnippetFilter
+		want      []int
+		wantTotal int
+	}{
+		{name: "No limit", filter: SnippetFilter{}, want: []int{quote, percent, frog, pond}, wantTotal: 4},
+		{name: "No limit with offset", filter: SnippetFilter{Offset: 1}, want: []int{percent, frog, pond}, wantTotal: 4},
+		{name: "Limit", filter: SnippetFilter{Limit: 2}, want: []int{quote, percent}, wantTotal: 4},
+		{name: "Limit and offset", filter: SnippetFilter{Limit: 2, Offset: 3}, want: []int{pond}, wantTotal: 4},
+		{name: "Search", filter: SnippetFilter{Search: "pond"}, want: []int{frog, pond}, wantTotal: 2},
+		{name: "Search including expired", filter: SnippetFilter{Search: "pond", IncludeExpired: true}, want: []int{expired, frog, pond}, wantTotal: 3},
+		{name: "Tag", filter: SnippetFilter{Tag: "haiku"}, want: []int{frog, pond}, wantTotal: 2},
+		{name: "Tag and owner", filter: SnippetFilter{Tag: "haiku", OwnerID: 1}, want: []int{pond}, wantTotal: 1},
+		{name: "Tag and search", filter: SnippetFilter{Tag: "haiku", Search: "frog"}, want: []int{frog}, wantTotal: 1},
+		{name: "Tag, owner and expired", filter: SnippetFilter{Tag: "haiku", OwnerID: 1, IncludeExpired: true, Sort: "oldest"}, want: []int{pond, expired}, wantTotal: 2},
+		{name: "Owner", filter: SnippetFilter{OwnerID: 2, Sort: "title"}, want: []int{frog, quote}, wantTotal: 2},
+		{name: "Literal percent", filter: SnippetFilter{Search: "100%"}, want: []int{percent}, wantTotal: 1},
+		{name: "Wildcard is literal", filter: SnippetFilter{Search: "%"}, want: []int{percent}, wantTotal: 1},
+		{name: "Injection in search", filter: SnippetFilter{Search: "' OR 1=1 --"}, want: []int{quote}, wantTotal: 1},
+		{name: "Injection in tag", filter: SnippetFilter{Tag: "' OR '1'='1"}, want: nil, wantTotal: 0},
+		{name: "Unknown tag", filter: SnippetFilter{Tag: "rust"}, want: nil, wantTotal: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippets, total, err := m.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int
+			for _, s := range snippets {
+				got = append(got, s.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v; want %v", got, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("got total %d; want %d", total, tt.wantTotal)
+			}
+
+			count, err := m.Count(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.wantTotal {
+				t.Errorf("got count %d; want %d", count, tt.wantTotal)
+			}
+		})
+	}
+
+	// The table is still there after all that.
+	_, err = m.Get(pond)
+	if err != nil {
+		t.Errorf("got error %v getting a snippet afterwards; want none", err)
+	}
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+)
+
+// InsertWithTags inserts a snippet as Insert does and gives it tags, all in
+// one transaction, so a snippet is never left without the tags it was created
+// with. Callers pass the tags already normalized and without repeats.
+func (m *SnippetModel) InsertWithTags(title string, content string, expires int, userID int, tags []string) (int, error) {
+	if !slices.Contains(PermittedExpiries, expires) {
+		return 0, ErrInvalidExpiry
+	}
+
+	stmt := insertSnippetStmt
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var id int
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		return m.withTx(ctx, func(tx *sql.Tx) error {
+			result, err := tx.ExecContext(ctx, stmt, title, Slugify(title), content, expires, userID, m.workspace())
+			if err != nil {
+				return err
+			}
+
+			lastID, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			id = int(lastID)
+
+			return insertTags(ctx, tx, id, tags)
+		})
+	})
+	if err != nil {
+		if mySQLErrorNumber(err) == mySQLDuplicateEntry {
+			return 0, ErrDuplicate
+		}
+		return 0, classifyError(err)
+	}
+
+	return id, nil
+}
+
+// Add tags to a snippet within tx.
+func insertTags(ctx context.Context, tx *sql.Tx, id int, tags []string) error {
+	stmt := `INSERT INTO snippet_tags (snippet_id, tag) VALUES(?, ?)`
+
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, stmt, id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Tags returns the tags of a snippet in the workspace, in alphabetical order.
+// A snippet without any (or which doesn't exist) has none.
+func (m *SnippetModel) Tags(id int) ([]string, error) {
+	stmt := `SELECT t.tag FROM snippet_tags t
+	INNER JOIN snippets s ON s.id = t.snippet_id
+	WHERE s.id = ? AND s.workspace_id = ?
+	ORDER BY t.tag ASC`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+	defer cancel()
+
+	rows, err := m.reader().QueryContext(ctx, stmt, id, m.workspace())
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	defer rows.Close()
+
+	var tags []string
+
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return tags, nil
+}
+
+// RenameTag renames a tag on every snippet in the workspace which has it, in
+// one transaction. A snippet which already has the new tag just keeps the
+// one, so renaming onto an existing tag merges the two. ErrNoRecord is
+// returned if no snippet has the old tag.
+func (m *SnippetModel) RenameTag(from, to string) error {
+	mergeStmt := `DELETE t FROM snippet_tags t
+	INNER JOIN snippet_tags n ON n.snippet_id = t.snippet_id AND n.tag = ?
+	INNER JOIN snippets s ON s.id = t.snippet_id
+	WHERE t.tag = ? AND s.workspace_id = ?`
+	renameStmt := `UPDATE snippet_tags t INNER JOIN snippets s ON s.id = t.snippet_id
+	SET t.tag = ? WHERE t.tag = ? AND s.workspace_id = ?`
+
+	// The merge would otherwise match every row against itself.
+	if from == to {
+		return nil
+	}
+
+	defer m.QueryHook.observe(m.baseContext(), renameStmt)()
+
+	var rows int64
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		return m.withTx(ctx, func(tx *sql.Tx) error {
+			rows = 0
+
+			for _, stmt := range []string{mergeStmt, renameStmt} {
+				result, err := tx.ExecContext(ctx, stmt, to, from, m.workspace())
+				if err != nil {
+					return err
+				}
+
+				n, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+				rows += n
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteTag removes a tag from every snippet in the workspace which has it.
+// The snippets themselves are left alone. ErrNoRecord is returned if no
+// snippet has the tag.
+func (m *SnippetModel) DeleteTag(tag string) error {
+	stmt := `DELETE t FROM snippet_tags t INNER JOIN snippets s ON s.id = t.snippet_id
+	WHERE t.tag = ? AND s.workspace_id = ?`
+
+	defer m.QueryHook.observe(m.baseContext(), stmt)()
+
+	var result sql.Result
+
+	err := withDeadlockRetry(func() error {
+		ctx, cancel := context.WithTimeout(m.baseContext(), queryTimeout)
+		defer cancel()
+
+		var err error
+		result, err = m.DB.ExecContext(ctx, stmt, tag, m.workspace())
+		return err
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Create the snippet_tags table if it does not exist. The primary key stops
+// a snippet having the same tag twice, and the index serves lookups by tag.
+func (m *SnippetModel) CreateTagTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS snippet_tags (
+			snippet_id INTEGER NOT NULL,
+			tag VARCHAR(20) NOT NULL,
+			PRIMARY KEY (snippet_id, tag),
+			INDEX idx_snippet_tags_tag (tag)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
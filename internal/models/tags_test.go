@@ -0,0 +1,148 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestInsertWithTags(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	id, err := m.InsertWithTags("Tagged", "Content", 7, 5, []string{"sql", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := m.Tags(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"go", "sql"}; !slices.Equal(tags, want) {
+		t.Errorf("got tags %q; want %q", tags, want)
+	}
+
+	// A tag which can't be stored takes the snippet with it.
+	_, err = m.InsertWithTags("Repeated tag", "Content", 7, 6, []string{"go", "go"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("got error %v; want %v", err, ErrDuplicate)
+	}
+
+	n, err := m.CountByUser(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d snippets after the failed insert; want 0", n)
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	first, err := m.InsertWithTags("First", "Content", 7, 0, []string{"golang", "sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.InsertWithTags("Second", "Content", 7, 0, []string{"golang", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other workspaces keep their tags.
+	other := m.ForWorkspace(DefaultWorkspaceID + 1)
+	elsewhere, err := other.InsertWithTags("Elsewhere", "Content", 7, 0, []string{"golang"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second snippet already has "go", so its "golang" merges into it.
+	err = m.RenameTag("golang", "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int][]string{first: {"go", "sql"}, second: {"go"}} {
+		tags, err := m.Tags(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(tags, want) {
+			t.Errorf("snippet %d: got tags %q; want %q", id, tags, want)
+		}
+	}
+
+	tags, err := other.Tags(elsewhere)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"golang"}; !slices.Equal(tags, want) {
+		t.Errorf("other workspace: got tags %q; want %q", tags, want)
+	}
+
+	err = m.RenameTag("golang", "go")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v renaming an unused tag; want %v", err, ErrNoRecord)
+	}
+
+	// Renaming a tag to itself changes nothing.
+	err = m.RenameTag("sql", "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err = m.Tags(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"go", "sql"}; !slices.Equal(tags, want) {
+		t.Errorf("after renaming to itself got tags %q; want %q", tags, want)
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	m := &SnippetModel{DB: newTestDB(t)}
+
+	first, err := m.InsertWithTags("First", "Content", 7, 0, []string{"go", "sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.InsertWithTags("Second", "Content", 7, 0, []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.DeleteTag("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int][]string{first: {"sql"}, second: nil} {
+		tags, err := m.Tags(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(tags, want) {
+			t.Errorf("snippet %d: got tags %q; want %q", id, tags, want)
+		}
+	}
+
+	// The join rows are gone, and the snippets are kept.
+	var n int
+	err = m.DB.QueryRow("SELECT COUNT(*) FROM snippet_tags WHERE tag = ?", "go").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d join rows for the deleted tag; want 0", n)
+	}
+
+	_, err = m.Get(second)
+	if err != nil {
+		t.Errorf("got error %v getting an untagged snippet; want none", err)
+	}
+
+	err = m.DeleteTag("go")
+	if !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got error %v deleting an unused tag; want %v", err, ErrNoRecord)
+	}
+}
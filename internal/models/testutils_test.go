@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+// Open the test database and set up the tables, dropping them again when the
+// test finishes. TEST_DSN names a MySQL database kept for the tests alone, e.g.
+// "test_web:pass@/test_snippetbox?parseTime=true&multiStatements=true"; tests
+// which need it are skipped when it isn't set.
+func newTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("models: TEST_DSN not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		defer db.Close()
+
+		for _, table := range []string{"snippets", "snippet_versions", "favorites", "snippet_tags", "sessions", "users", "api_tokens", "workspaces", "rate_limits", "reports"} {
+			_, err := db.Exec("DROP TABLE IF EXISTS " + table)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	err = (&SnippetModel{DB: db}).SeedDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&UserModel{DB: db}).SeedDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&WorkspaceModel{DB: db}).SeedDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&ReportModel{DB: db}).SeedDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Define a User type. The fields mirror the columns in the users table.
+type User struct {
+	ID             int
+	Name           string
+	Email          string
+	HashedPassword []byte
+	Created        time.Time
+	IsAdmin        bool
+	WorkspaceID    int
+}
+
+// UserModelInterface describes the user methods the web handlers and
+// middleware use, so they can be given a mock instead of a database-backed
+// UserModel.
+type UserModelInterface interface {
+	Insert(name, email, password string) (int, error)
+	Authenticate(email, password string) (int, error)
+	SetAdmin(id int, admin bool) error
+	Get(id int) (User, error)
+	NewAPIToken(userID int) (string, error)
+	AuthenticateToken(token string) (User, error)
+	RevokeAPITokens(userID int) error
+}
+
+// Define a UserModel type which wraps a database connection pool.
+type UserModel struct {
+	DB        *sql.DB
+	QueryHook QueryHook
+}
+
+// Insert adds a new user, storing a bcrypt hash of the password, and returns
+// the new user's id. ErrDuplicateEmail is returned if the email is taken.
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, fmt.Errorf("models: hash password: %w", err)
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created)
+	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if err != nil {
+		// A duplicate entry on the unique email constraint means the address
+		// is already registered.
+		if isDuplicateKey(err, "users_uc_email") {
+			return 0, ErrDuplicateEmail
+		}
+		return 0, classifyError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Authenticate checks an email and password against the users table and
+// returns the matching user's id, or ErrInvalidCredentials if either the email
+// is unknown or the password doesn't match.
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	var id int
+	var hashedPassword []byte
+
+	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, classifyError(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// SetAdmin grants or revokes the admin flag for a user.
+func (m *UserModel) SetAdmin(id int, admin bool) error {
+	stmt := `UPDATE users SET is_admin = ? WHERE id = ?`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, admin, id)
+	return classifyError(err)
+}
+
+// Get returns the user with the given id, or ErrNoRecord if there isn't one.
+func (m *UserModel) Get(id int) (User, error) {
+	var u User
+
+	stmt := `SELECT id, name, email, created, is_admin, workspace_id FROM users WHERE id = ?`
+
+	defer m.QueryHook.observe(context.Background(), stmt)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.IsAdmin, &u.WorkspaceID)
+	if err != nil {
+		return User{}, classifyError(err)
+	}
+
+	return u, nil
+}
+
+// Create users table if it does not exist.
+func (m *UserModel) CreateUserTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+			name VARCHAR(255) NOT NULL,
+			email VARCHAR(255) NOT NULL,
+			hashed_password CHAR(60) NOT NULL,
+			created DATETIME NOT NULL,
+			is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+			workspace_id INTEGER NOT NULL DEFAULT 1,
+			CONSTRAINT users_uc_email UNIQUE (email)
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Dev seed database.
+func (m *UserModel) SeedDatabase() error {
+	exists, err := tableExists(m.DB, "users")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := m.CreateUserTable(); err != nil {
+			return err
+		}
+	}
+
+	// Tables from before admins existed need the column adding.
+	err = addColumn(m.DB, "users", "is_admin", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return err
+	}
+
+	exists, err = tableExists(m.DB, "api_tokens")
+	if err != nil || exists {
+		return err
+	}
+
+	return m.CreateAPITokenTable()
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// The workspace existing data (and anyone not assigned elsewhere) belongs to.
+const DefaultWorkspaceID = 1
+
+// Define a Workspace type. Snippets and users each belong to one workspace,
+// and users only ever see the snippets in theirs.
+type Workspace struct {
+	ID      int
+	Name    string
+	Created time.Time
+}
+
+// Define a WorkspaceModel type which wraps a database connection pool.
+type WorkspaceModel struct {
+	DB *sql.DB
+}
+
+// Create the workspaces table if it does not exist.
+func (m *WorkspaceModel) CreateWorkspaceTable() error {
+	stmt := `
+		CREATE TABLE IF NOT EXISTS workspaces (
+			id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+			name VARCHAR(255) NOT NULL,
+			created DATETIME NOT NULL
+		)
+	`
+	_, err := m.DB.Exec(stmt)
+	return err
+}
+
+// Create the default workspace if it doesn't exist yet.
+func (m *WorkspaceModel) CreateDefaultWorkspace() error {
+	stmt := `INSERT IGNORE INTO workspaces (id, name, created) VALUES (?, 'Default', UTC_TIMESTAMP())`
+	_, err := m.DB.Exec(stmt, DefaultWorkspaceID)
+	return err
+}
+
+// Add a workspace_id column to a table created before workspaces existed.
+// Existing rows end up in the default workspace.
+func (m *WorkspaceModel) AddWorkspaceColumn(table string) error {
+	exists, err := columnExists(m.DB, table, "workspace_id")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = m.DB.Exec(`ALTER TABLE ` + table + ` ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1`)
+	return err
+}
+
+// Dev seed database. Run it after the snippets and users tables have been
+// set up, so older copies of them get their workspace_id column.
+func (m *WorkspaceModel) SeedDatabase() error {
+	exists, err := tableExists(m.DB, "workspaces")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := m.CreateWorkspaceTable(); err != nil {
+			return err
+		}
+	}
+
+	if err := m.CreateDefaultWorkspace(); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"snippets", "users"} {
+		if err := m.AddWorkspaceColumn(table); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,20 +1,39 @@
 package validator
 
 import (
+	"fmt"
+	"regexp"
 	"slices"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
+// Use the regexp.MustCompile() function to parse a regular expression pattern
+// for sanity checking the format of an email address. This returns a pointer to
+// a 'compiled' regexp.Regexp type, or panics in the event of an error. Parsing
+// this pattern once at startup and storing the compiled *regexp.Regexp in a
+// variable is more performant than re-parsing the pattern each time we need it.
+// The pattern is the one recommended by the W3C for HTML5 email inputs.
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
 // Define a new Validator struct which contains a map of validation error messages
-// for our form fields.
+// for our form fields, plus a slice for errors which don't relate to a specific
+// field.
 type Validator struct {
-	FieldErrors map[string]string
+	NonFieldErrors []string
+	FieldErrors    map[string]string
 }
 
-// Valid() returns true if the FieldErrors map doesn't contain any entries.
+// Valid() returns true if the FieldErrors map and NonFieldErrors slice don't
+// contain any entries.
 func (v *Validator) Valid() bool {
-	return len(v.FieldErrors) == 0
+	return len(v.FieldErrors) == 0 && len(v.NonFieldErrors) == 0
+}
+
+// AddNonFieldError() adds an error message to the NonFieldErrors slice.
+func (v *Validator) AddNonFieldError(message string) {
+	v.NonFieldErrors = append(v.NonFieldErrors, message)
 }
 
 // AddFieldError() adds an error message to the FieldErrors map (so long as no
@@ -39,6 +58,23 @@ func (v *Validator) CheckField(ok bool, key, message string) {
 	}
 }
 
+// FieldKey() returns the FieldErrors key for the value at index i of a field
+// which takes several values, e.g. "tags[2]".
+func FieldKey(key string, i int) string {
+	return fmt.Sprintf("%s[%d]", key, i)
+}
+
+// CheckEach() runs a check over every value of a field which takes several
+// values, adding an error message under FieldKey(key, i) for each value which
+// is not 'ok'.
+func (v *Validator) CheckEach(values []string, key string, ok func(string) bool, message string) {
+	for i, value := range values {
+		if !ok(value) {
+			v.AddFieldError(FieldKey(key, i), message)
+		}
+	}
+}
+
 // NotBlank() returns true if a value is not an empty string.
 func NotBlank(value string) bool {
 	return strings.TrimSpace(value) != ""
@@ -49,8 +85,51 @@ func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
+// ValidUTF8() returns true if a value is valid UTF-8 text.
+func ValidUTF8(value string) bool {
+	return utf8.ValidString(value)
+}
+
+// MaxBytes() returns true if a value is no more than n bytes long. Use it
+// rather than MaxChars() when the limit is about storage size.
+func MaxBytes(value string, n int) bool {
+	return len(value) <= n
+}
+
+// MinChars() returns true if a value contains at least n characters. Like
+// MaxChars() it counts runes, so multi-byte characters count once.
+func MinChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) >= n
+}
+
+// StrongPassword() returns true if a value is at least 8 characters long and
+// mixes letters with at least one digit or symbol. Letters from any script
+// count, so non-Latin passwords aren't rejected.
+func StrongPassword(value string) bool {
+	if !MinChars(value, 8) {
+		return false
+	}
+
+	var hasLetter, hasOther bool
+	for _, r := range value {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		} else if !unicode.IsSpace(r) {
+			hasOther = true
+		}
+	}
+
+	return hasLetter && hasOther
+}
+
 // PermittedValue() returns true if a value is in a list of specific permitted
 // values.
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
 }
+
+// Matches() returns true if a value matches a provided compiled regular
+// expression pattern.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
@@ -0,0 +1,97 @@
+package validator
+
+import "testing"
+
+func TestMinChars(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		n     int
+		want  bool
+	}{
+		{"Long enough", "password", 8, true},
+		{"Too short", "passwor", 8, false},
+		{"Multi-byte counted once", "пароль12", 8, true},
+		{"Multi-byte too short", "пароль1", 8, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MinChars(tt.value, tt.n); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrongPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"Letters and digits", "pa55word", true},
+		{"Letters and symbols", "pa$$word", true},
+		{"Non-Latin letters", "пароль-1", true},
+		{"Too short", "pa$$1", false},
+		{"Letters only", "passwords", false},
+		{"Digits only", "12345678", false},
+		{"Spaces don't count as symbols", "pass word", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StrongPassword(tt.password); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@example.com", true},
+		{"alice+snippets@example.com", true},
+		{"alice.smith@mail.example.co.uk", true},
+		// The HTML5 pattern allows hosts without a TLD, as browsers do.
+		{"alice@localhost", true},
+		{"alice@", false},
+		{"@example.com", false},
+		{"alice example@example.com", false},
+		{"alice@example..com", false},
+		{"alice@-example.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := Matches(tt.email, EmailRX); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidUTF8(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"ASCII", "An old silent pond", true},
+		{"Multi-byte", "古池や蛙飛び込む水の音", true},
+		{"Invalid byte", "bad \xff byte", false},
+		{"Truncated sequence", "\xe6\x97", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidUTF8(tt.value); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
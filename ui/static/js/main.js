@@ -1,3 +1,6 @@
+// Prefix for links within the site, when it's served under a sub-path.
+var basePath = document.body.dataset.basePath || "";
+
 var navLinks = document.querySelectorAll("nav a");
 for (var i = 0; i < navLinks.length; i++) {
 	var link = navLinks[i]
@@ -5,4 +8,22 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// On the home page, add newly created snippets to the top of the listing as
+// they arrive.
+var latest = document.getElementById("latest");
+if (latest && window.EventSource) {
+	var events = new EventSource(basePath + "/events");
+	events.onmessage = function(e) {
+		var snippet = JSON.parse(e.data);
+
+		var row = latest.insertRow(1);
+		var title = row.insertCell(0);
+		var link = document.createElement("a");
+		link.href = basePath + "/snippet/view/" + snippet.id;
+		link.textContent = snippet.title;
+		title.appendChild(link);
+		row.insertCell(1).textContent = "Just now";
+		row.insertCell(2).textContent = "#" + snippet.id;
+	};
+}